@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// remarkOrder ips 名称的稳定顺序: 先按 remarkOrder 配置, 其余按名称排序
+func remarkOrder() []string {
+	names := make([]string, 0, len(config.Ips))
+	listed := make(map[string]bool)
+	for _, name := range config.RemarkOrder {
+		if _, ok := config.Ips[name]; ok && !listed[name] {
+			names = append(names, name)
+			listed[name] = true
+		}
+	}
+	rest := make([]string, 0, len(config.Ips))
+	for name := range config.Ips {
+		if !listed[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+// subdomainRemarks 按稳定顺序返回子域名配置所使用的 ips 名称
+func subdomainRemarks(subDomains []string, subDomain string) []string {
+	var names []string
+	for _, remark := range remarkOrder() {
+		for _, s := range subDomains {
+			rmk, sub := parseSubdomain(s)
+			if sub != subDomain {
+				continue
+			}
+			if (len(rmk) > 0 || strings.HasPrefix(remark, ".")) && rmk != remark {
+				continue
+			}
+			names = append(names, remark)
+			break
+		}
+	}
+	return names
+}
+
+// familyOf HTTPS 记录随 A 记录发布
+func familyOf(recordType string) string {
+	if recordType == "HTTPS" {
+		return "A"
+	}
+	return recordType
+}
+
+// remarkMatches 记录值是否对应该 ips 名称当前获取到的 IP
+func remarkMatches(recordType, value string, addrs *addresses) bool {
+	ips, ok := addrs.ips[familyOf(recordType)]
+	if !ok {
+		return false
+	}
+	if recordType == "HTTPS" {
+		r, err := parseSvcb(0, value)
+		return err == nil && r.Params["ipv4hint"] == strings.Join(sortedCopy(ips), ",")
+	}
+	for _, ip := range ips {
+		if value == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// assignRemarks 为待接管的无备注记录分配 ips 名称.
+// 先按记录值与当前 IP 匹配(同一名称可匹配记录集合中的多条记录), 剩余记录按 RecordId 与名称稳定顺序依次分配;
+// 多个名称对应同一值等无法确定的情况只报告不分配. taken 为已有托管记录占用的 子域名/类型/名称
+func assignRemarks(domain string, subDomains []string, records []*dnspod.RecordListItem, taken map[string]bool, remarks map[string]*addresses) map[uint64]string {
+	assigned := make(map[uint64]string)
+	groups := make(map[string][]*dnspod.RecordListItem)
+	var keys []string
+	for _, record := range records {
+		key := *record.Name + "/" + *record.Type
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], record)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		group := groups[key]
+		sort.Slice(group, func(i, j int) bool { return *group[i].RecordId < *group[j].RecordId })
+		subDomain, recordType := *group[0].Name, *group[0].Type
+		var candidates []string
+		resolved := make(map[string]*addresses)
+		for _, name := range subdomainRemarks(subDomains, subDomain) {
+			addrs, ok := remarks[name]
+			if !ok {
+				continue
+			}
+			addrs = addrs.forSubdomain(domain, subDomain)
+			if _, ok := addrs.ips[familyOf(recordType)]; !ok {
+				continue
+			}
+			resolved[name] = addrs
+			candidates = append(candidates, name)
+		}
+		var rest []*dnspod.RecordListItem
+		for _, record := range group {
+			var matched []string
+			for _, name := range candidates {
+				if remarkMatches(recordType, *record.Value, resolved[name]) {
+					matched = append(matched, name)
+				}
+			}
+			switch {
+			case len(matched) == 1 && !taken[key+"/"+matched[0]+"/"+*record.Value]:
+				assigned[*record.RecordId] = matched[0]
+				taken[key+"/"+matched[0]] = true
+				taken[key+"/"+matched[0]+"/"+*record.Value] = true
+			case len(matched) == 1:
+				fmt.Printf("[%s] ambiguous %s.%s[%s] %s: %s already assigned\n", time.Now().Format("2006-01-02 15:04:05"), subDomain, domain, recordType, *record.Value, matched[0])
+			case len(matched) > 1:
+				fmt.Printf("[%s] ambiguous %s.%s[%s] %s: matches %v\n", time.Now().Format("2006-01-02 15:04:05"), subDomain, domain, recordType, *record.Value, matched)
+			default:
+				rest = append(rest, record)
+			}
+		}
+		for _, record := range rest {
+			name := ""
+			for _, n := range candidates {
+				if !taken[key+"/"+n] {
+					name = n
+					break
+				}
+			}
+			if name == "" {
+				fmt.Printf("[%s] no remark left for %s.%s[%s] %s\n", time.Now().Format("2006-01-02 15:04:05"), subDomain, domain, recordType, *record.Value)
+				continue
+			}
+			assigned[*record.RecordId] = name
+			taken[key+"/"+name] = true
+		}
+	}
+	return assigned
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+func listItem(id uint64, name, recordType, value string) *dnspod.RecordListItem {
+	remark := ""
+	return &dnspod.RecordListItem{RecordId: &id, Name: &name, Type: &recordType, Value: &value, Remark: &remark}
+}
+
+func ipv4(ips ...string) *addresses {
+	return &addresses{ips: map[string][]string{"A": ips}, failed: make(map[string]bool)}
+}
+
+func TestAssignRemarks(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+
+	tests := []struct {
+		name       string
+		order      []string
+		subDomains []string
+		records    []*dnspod.RecordListItem
+		taken      map[string]bool
+		remarks    map[string]*addresses
+		want       map[uint64]string
+	}{
+		{
+			name:       "match by value",
+			subDomains: []string{"www"},
+			records:    []*dnspod.RecordListItem{listItem(1, "www", "A", "192.0.2.2"), listItem(2, "www", "A", "192.0.2.1")},
+			remarks:    map[string]*addresses{"telecom": ipv4("192.0.2.1"), "unicom": ipv4("192.0.2.2")},
+			want:       map[uint64]string{1: "unicom", 2: "telecom"},
+		},
+		{
+			name:       "record set of one remark",
+			subDomains: []string{"www"},
+			records:    []*dnspod.RecordListItem{listItem(1, "www", "A", "192.0.2.1"), listItem(2, "www", "A", "192.0.2.2")},
+			remarks:    map[string]*addresses{"telecom": ipv4("192.0.2.1", "192.0.2.2"), "unicom": ipv4("198.51.100.1")},
+			want:       map[uint64]string{1: "telecom", 2: "telecom"},
+		},
+		{
+			name:       "unmatched in id and name order",
+			subDomains: []string{"www"},
+			records:    []*dnspod.RecordListItem{listItem(5, "www", "A", "203.0.113.5"), listItem(3, "www", "A", "203.0.113.3")},
+			remarks:    map[string]*addresses{"telecom": ipv4("192.0.2.1"), "unicom": ipv4("192.0.2.2")},
+			want:       map[uint64]string{3: "telecom", 5: "unicom"},
+		},
+		{
+			name:       "remarkOrder first",
+			order:      []string{"unicom"},
+			subDomains: []string{"www"},
+			records:    []*dnspod.RecordListItem{listItem(5, "www", "A", "203.0.113.5"), listItem(3, "www", "A", "203.0.113.3")},
+			remarks:    map[string]*addresses{"telecom": ipv4("192.0.2.1"), "unicom": ipv4("192.0.2.2")},
+			want:       map[uint64]string{3: "unicom", 5: "telecom"},
+		},
+		{
+			name:       "same value for two remarks",
+			subDomains: []string{"www"},
+			records:    []*dnspod.RecordListItem{listItem(1, "www", "A", "192.0.2.1")},
+			remarks:    map[string]*addresses{"telecom": ipv4("192.0.2.1"), "unicom": ipv4("192.0.2.1")},
+			want:       map[uint64]string{},
+		},
+		{
+			name:       "taken remark skipped",
+			subDomains: []string{"www"},
+			records:    []*dnspod.RecordListItem{listItem(1, "www", "A", "203.0.113.1")},
+			taken:      map[string]bool{"www/A/telecom": true},
+			remarks:    map[string]*addresses{"telecom": ipv4("192.0.2.1"), "unicom": ipv4("192.0.2.2")},
+			want:       map[uint64]string{1: "unicom"},
+		},
+		{
+			name:       "more records than remarks",
+			subDomains: []string{"www"},
+			records:    []*dnspod.RecordListItem{listItem(1, "www", "A", "203.0.113.1"), listItem(2, "www", "A", "203.0.113.2")},
+			remarks:    map[string]*addresses{"telecom": ipv4("192.0.2.1")},
+			want:       map[uint64]string{1: "telecom"},
+		},
+		{
+			name:       "only remarks of the subdomain",
+			subDomains: []string{"www#unicom"},
+			records:    []*dnspod.RecordListItem{listItem(1, "www", "A", "192.0.2.1")},
+			remarks:    map[string]*addresses{"telecom": ipv4("192.0.2.1"), "unicom": ipv4("192.0.2.2")},
+			want:       map[uint64]string{1: "unicom"},
+		},
+		{
+			name:       "family without addresses",
+			subDomains: []string{"www"},
+			records:    []*dnspod.RecordListItem{listItem(1, "www", "AAAA", "2001:db8::1")},
+			remarks:    map[string]*addresses{"telecom": ipv4("192.0.2.1")},
+			want:       map[uint64]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config = Config{Ips: make(map[string]IpSource), RemarkOrder: tt.order}
+			for name := range tt.remarks {
+				config.Ips[name] = IpSource{}
+			}
+			taken := tt.taken
+			if taken == nil {
+				taken = make(map[string]bool)
+			}
+			got := assignRemarks("example.com", tt.subDomains, tt.records, taken, tt.remarks)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("assignRemarks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
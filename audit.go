@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// HistoryConfig 每个子域名变更历史的保留限制, 默认保留 1000 条, 不限时间
+type HistoryConfig struct {
+	MaxEntries int    `json:"maxEntries"`
+	MaxAge     string `json:"maxAge"`
+}
+
+// auditEntry 一次记录变更或地址变化. Action 为 create/update/delete/disable/enable/remark,
+// remark 时 Old/Value 为新旧备注; ips 名称的历史中为 detect, Value 为获取到的地址
+type auditEntry struct {
+	Time     int64  `json:"time"`
+	Remark   string `json:"remark"`
+	Type     string `json:"type"`
+	Action   string `json:"action"`
+	Old      string `json:"old"`
+	Value    string `json:"value"`
+	RecordId uint64 `json:"recordId"`
+}
+
+var auditGuard sync.Mutex
+
+// auditDir 变更历史目录, 与缓存同级, 每个 子域名.域名 一个文件
+func auditDir() string {
+	return *cachePath + ".history"
+}
+
+// fullName 子域名.域名, @ 为域名本身
+func fullName(domain, subDomain string) string {
+	if subDomain == "@" || subDomain == "" {
+		return domain
+	}
+	return subDomain + "." + domain
+}
+
+// detectionName ips 名称的地址历史文件名
+func detectionName(remark string) string {
+	return "ips/" + remark
+}
+
+// auditRemark 历史中使用的名称: 托管记录为去掉前缀的名称, 其余为原备注
+func auditRemark(remark *string) string {
+	if remark == nil {
+		return ""
+	}
+	if name, ok := ownedRemark(*remark); ok {
+		return name
+	}
+	return *remark
+}
+
+// auditChange 记录子域名下某条记录的变更, 并按保留限制清理旧记录
+func auditChange(domain, subDomain, remark, recordType, action, old, value string, recordId *uint64) {
+	entry := auditEntry{Time: time.Now().Unix(), Remark: remark, Type: recordType, Action: action, Old: old, Value: value}
+	if recordId != nil {
+		entry.RecordId = *recordId
+	}
+	auditGuard.Lock()
+	defer auditGuard.Unlock()
+	name := fullName(domain, subDomain)
+	entries, _ := readAudit(name)
+	appendAudit(name, entries, entry)
+}
+
+// auditDetection 记录 ips 名称获取到的地址, 与上一条相同时不记录
+func auditDetection(remark, summary string) {
+	auditGuard.Lock()
+	defer auditGuard.Unlock()
+	name := detectionName(remark)
+	entries, _ := readAudit(name)
+	old := ""
+	if len(entries) > 0 {
+		old = entries[len(entries)-1].Value
+		if old == summary {
+			return
+		}
+	}
+	appendAudit(name, entries, auditEntry{Time: time.Now().Unix(), Remark: remark, Action: "detect", Old: old, Value: summary})
+}
+
+// appendAudit 追加一条历史并按保留限制清理旧记录, 调用方持有 auditGuard
+func appendAudit(name string, entries []auditEntry, entry auditEntry) {
+	entries = append(entries, entry)
+	maxEntries := config.History.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 1000
+	}
+	if len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+	}
+	if maxAge, err := time.ParseDuration(config.History.MaxAge); err == nil && maxAge > 0 {
+		since := time.Now().Add(-maxAge).Unix()
+		for len(entries) > 0 && entries[0].Time < since {
+			entries = entries[1:]
+		}
+	}
+	if err := writeAudit(name, entries); err != nil {
+		fmt.Printf("history: %s\n", err)
+	}
+}
+
+func readAudit(name string) ([]auditEntry, error) {
+	f, err := os.Open(filepath.Join(auditDir(), name+".jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	var entries []auditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// writeAudit 写入临时文件后替换, 避免中断时丢失历史
+func writeAudit(name string, entries []auditEntry) error {
+	location := filepath.Join(auditDir(), name+".jsonl")
+	if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(location + ".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, entry := range entries {
+		line, _ := json.Marshal(entry)
+		_, _ = w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(location+".tmp", location)
+}
+
+// auditCommand history [-o table|csv|json] [-r 名称] <子域名.域名> 打印记录的变更历史;
+// history [-o table|csv|json] -ips 名称 打印 ips 名称获取到的地址历史
+func auditCommand(args []string) error {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	format := flags.String("o", "table", "输出格式: table, csv 或 json")
+	remark := flags.String("r", "", "只显示该名称的记录")
+	ips := flags.String("ips", "", "显示该 ips 名称的地址历史")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	name := detectionName(*ips)
+	if *ips == "" {
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: history [-o table|csv|json] [-r remark] <sub.domain> | history [-o table|csv|json] -ips <name>")
+		}
+		name = strings.TrimSuffix(flags.Arg(0), ".")
+	}
+	entries, err := readAudit(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no history for %s", name)
+		}
+		return err
+	}
+	if *remark != "" {
+		kept := entries[:0]
+		for _, entry := range entries {
+			if entry.Remark == *remark {
+				kept = append(kept, entry)
+			}
+		}
+		entries = kept
+	}
+	switch *format {
+	case "json":
+		out, _ := json.MarshalIndent(entries, "", "  ")
+		fmt.Println(string(out))
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		_ = w.Write([]string{"time", "remark", "type", "action", "old", "value", "recordId"})
+		for _, e := range entries {
+			_ = w.Write([]string{time.Unix(e.Time, 0).Format(time.RFC3339), e.Remark, e.Type, e.Action, e.Old, e.Value, strconv.FormatUint(e.RecordId, 10)})
+		}
+		w.Flush()
+		return w.Error()
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "TIME\tREMARK\tTYPE\tACTION\tOLD\tVALUE")
+		for _, e := range entries {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", time.Unix(e.Time, 0).Format("2006-01-02 15:04:05"), e.Remark, e.Type, e.Action, e.Old, e.Value)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown format %s", *format)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"dnspod-ddns/db"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// pendingRecord 等待批量提交的 A/AAAA 记录创建或修改
+type pendingRecord struct {
+	section   *db.Section
+	subDomain string
+	remark    string
+	dnsType   string
+	value     string
+	record    *dnspod.RecordInfo // 修改时为原记录
+	recordId  *uint64            // 批量创建返回的记录 Id, 任务未执行完时为空
+	requestId *string            // 批量请求的 RequestId, 用于记入运行日志
+}
+
+var (
+	batchGuard    sync.Mutex
+	pendingModify []pendingRecord
+	pendingCreate []pendingRecord
+)
+
+// 批量任务异步执行, 提交后从记录列表确认结果, 最多确认 batchConfirmTries 次
+const (
+	batchConfirmTries = 3
+	batchConfirmDelay = 2 * time.Second
+)
+
+// batchEnabled 是否使用批量接口, 默认开启
+func batchEnabled() bool {
+	return !config.NoBatch
+}
+
+func queueModify(p pendingRecord) {
+	batchGuard.Lock()
+	defer batchGuard.Unlock()
+	pendingModify = append(pendingModify, p)
+}
+
+func queueCreate(p pendingRecord) {
+	batchGuard.Lock()
+	defer batchGuard.Unlock()
+	pendingCreate = append(pendingCreate, p)
+}
+
+// flushBatch 提交域名下等待的修改与创建. 改为同一值的记录使用 ModifyRecordBatch, 新记录使用 CreateRecordBatch,
+// 只有一条或批量接口失败时逐条调用. 批量提交的记录随后从记录列表确认并更新缓存
+func flushBatch(domainInfo *dnspod.DomainInfo, client *dnspod.Client) {
+	batchGuard.Lock()
+	modifies, creates := pendingModify, pendingCreate
+	pendingModify, pendingCreate = nil, nil
+	batchGuard.Unlock()
+
+	groups := make(map[string][]pendingRecord)
+	var values []string
+	for _, p := range modifies {
+		if _, ok := groups[p.value]; !ok {
+			values = append(values, p.value)
+		}
+		groups[p.value] = append(groups[p.value], p)
+	}
+	var submitted []pendingRecord
+	for _, value := range values {
+		if group := groups[value]; len(group) > 1 {
+			submitted = append(submitted, modifyBatch(domainInfo, group, client)...)
+		} else {
+			modifySingle(domainInfo, group[0], client)
+		}
+	}
+	if len(creates) > 1 {
+		submitted = append(submitted, createBatch(domainInfo, creates, client)...)
+	} else if len(creates) == 1 {
+		createSingle(domainInfo, creates[0], client)
+	}
+	confirmBatch(domainInfo, submitted, client)
+}
+
+func modifySingle(domainInfo *dnspod.DomainInfo, p pendingRecord, client *dnspod.Client) {
+	updateRecord(&p.subDomain, domainInfo, &p.value, client, p.record, p.section, &p.remark, nil)
+}
+
+func createSingle(domainInfo *dnspod.DomainInfo, p pendingRecord, client *dnspod.Client) {
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	createRecord(&p.subDomain, domainInfo, &p.value, client, p.section, &p.remark, &wg)
+}
+
+// modifyBatch 批量修改记录值, 返回已提交到批量任务的记录
+func modifyBatch(domainInfo *dnspod.DomainInfo, group []pendingRecord, client *dnspod.Client) []pendingRecord {
+	value := group[0].value
+	fmt.Printf("[%s] Updating %d records of %s in batch, IP:%s\n", time.Now().Format("2006-01-02 15:04:05"), len(group), *domainInfo.Domain, value)
+	request := dnspod.NewModifyRecordBatchRequest()
+	change := "value"
+	request.Change = &change
+	request.ChangeTo = &value
+	for _, p := range group {
+		request.RecordIdList = append(request.RecordIdList, p.record.Id)
+	}
+	<-rateLimiter
+	response, err := client.ModifyRecordBatch(request)
+	if err != nil || response == nil || response.Response == nil {
+		fmt.Printf("ModifyRecordBatch failed, updating one by one: %v\n", err)
+		for _, p := range group {
+			modifySingle(domainInfo, p, client)
+		}
+		return nil
+	}
+	failed := make(map[uint64]string)
+	for _, detail := range response.Response.DetailList {
+		for _, r := range detail.RecordList {
+			if r.RecordId != nil && batchRecordFailed(r.Status, r.ErrMsg) {
+				failed[*r.RecordId] = stringValue(r.ErrMsg)
+			}
+		}
+	}
+	var submitted []pendingRecord
+	for _, p := range group {
+		if msg, ok := failed[*p.record.Id]; ok {
+			fmt.Printf("batch update %s.%s[%s] failed: %s, retrying alone\n", p.subDomain, *domainInfo.Domain, p.remark, msg)
+			modifySingle(domainInfo, p, client)
+			continue
+		}
+		// 与单条修改一致地记入运行日志
+		single := dnspod.NewModifyRecordRequest()
+		single.Domain = domainInfo.Domain
+		single.RecordId = p.record.Id
+		single.SubDomain = p.record.SubDomain
+		single.RecordType = p.record.RecordType
+		single.RecordLine = p.record.RecordLine
+		single.RecordLineId = p.record.RecordLineId
+		single.Remark = p.record.Remark
+		single.Value = &p.value
+		writeJournal("ModifyRecord", domainInfo.Domain, p.record.Id, p.record, single, response.Response.RequestId)
+		auditChange(*domainInfo.Domain, p.subDomain, p.remark, p.dnsType, "update", stringValue(p.record.Value), p.value, p.record.Id)
+		submitted = append(submitted, p)
+	}
+	return submitted
+}
+
+// createBatch 批量创建记录, 返回已提交到批量任务的记录
+func createBatch(domainInfo *dnspod.DomainInfo, creates []pendingRecord, client *dnspod.Client) []pendingRecord {
+	fmt.Printf("[%s] creating %d records of %s in batch\n", time.Now().Format("2006-01-02 15:04:05"), len(creates), *domainInfo.Domain)
+	if domainInfo.DomainId == nil {
+		for _, p := range creates {
+			createSingle(domainInfo, p, client)
+		}
+		return nil
+	}
+	recordLine := "默认"
+	request := dnspod.NewCreateRecordBatchRequest()
+	domainId := strconv.FormatUint(*domainInfo.DomainId, 10)
+	request.DomainIdList = []*string{&domainId}
+	for i := range creates {
+		p := &creates[i]
+		dnsRemark := recordRemark(p.remark)
+		request.RecordList = append(request.RecordList, &dnspod.AddRecordBatch{
+			RecordType: &p.dnsType,
+			Value:      &p.value,
+			SubDomain:  &p.subDomain,
+			RecordLine: &recordLine,
+			Remark:     &dnsRemark,
+		})
+	}
+	<-rateLimiter
+	response, err := client.CreateRecordBatch(request)
+	if err != nil || response == nil || response.Response == nil {
+		fmt.Printf("CreateRecordBatch failed, creating one by one: %v\n", err)
+		for _, p := range creates {
+			createSingle(domainInfo, p, client)
+		}
+		return nil
+	}
+	results := make(map[string]*dnspod.CreateRecordBatchRecord)
+	for _, detail := range response.Response.DetailList {
+		for _, r := range detail.RecordList {
+			results[stringValue(r.SubDomain)+"/"+stringValue(r.RecordType)+"/"+stringValue(r.Value)] = r
+		}
+	}
+	var submitted []pendingRecord
+	for _, p := range creates {
+		r, ok := results[p.subDomain+"/"+p.dnsType+"/"+p.value]
+		if ok && batchRecordFailed(r.Status, r.ErrMsg) {
+			fmt.Printf("batch create %s.%s[%s] failed: %s, retrying alone\n", p.subDomain, *domainInfo.Domain, p.remark, stringValue(r.ErrMsg))
+			createSingle(domainInfo, p, client)
+			continue
+		}
+		p.requestId = response.Response.RequestId
+		if ok && r.RecordId != nil {
+			p.recordId = r.RecordId
+			journalBatchCreate(domainInfo, p, p.recordId)
+		}
+		// 任务仍在执行时记录 Id 未知, 确认后再记入运行日志; 不重新创建以免产生重复记录
+		auditChange(*domainInfo.Domain, p.subDomain, p.remark, p.dnsType, "create", "", p.value, p.recordId)
+		submitted = append(submitted, p)
+	}
+	return submitted
+}
+
+// journalBatchCreate 与单条创建一致地记入运行日志. recordId 为空时 rollback 按记录内容查找
+func journalBatchCreate(domainInfo *dnspod.DomainInfo, p pendingRecord, recordId *uint64) {
+	recordLine := "默认"
+	dnsRemark := recordRemark(p.remark)
+	single := dnspod.NewCreateRecordRequest()
+	single.Domain = domainInfo.Domain
+	single.SubDomain = &p.subDomain
+	single.RecordType = &p.dnsType
+	single.RecordLine = &recordLine
+	single.Value = &p.value
+	single.Remark = &dnsRemark
+	writeJournal("CreateRecord", domainInfo.Domain, recordId, nil, single, p.requestId)
+}
+
+// confirmBatch 从域名的记录列表确认批量任务的结果, 只更新受影响记录的缓存.
+// 多次确认后仍未生效的记录, 由下次运行刷新该域名的缓存
+func confirmBatch(domainInfo *dnspod.DomainInfo, submitted []pendingRecord, client *dnspod.Client) {
+	if len(submitted) == 0 {
+		return
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, p := range submitted {
+		if !seen[p.subDomain] {
+			seen[p.subDomain] = true
+			names = append(names, p.subDomain)
+		}
+	}
+	for try := 0; try < batchConfirmTries && len(submitted) > 0; try++ {
+		if try > 0 {
+			time.Sleep(batchConfirmDelay)
+		}
+		records, err := listDomainRecords(*domainInfo.Domain, names, client)
+		if err != nil {
+			fmt.Printf("DescribeRecordList failed: %s\n", err)
+			break
+		}
+		submitted = applyBatchResult(domainInfo, submitted, records)
+	}
+	if len(submitted) == 0 {
+		return
+	}
+	for _, p := range submitted {
+		fmt.Printf("[%s] batch change of %s.%s[%s] not confirmed, cache will be refreshed\n", time.Now().Format("2006-01-02 15:04:05"), p.subDomain, *domainInfo.Domain, p.remark)
+		if p.record == nil && p.recordId == nil {
+			journalBatchCreate(domainInfo, p, nil)
+		}
+	}
+	markRefresh(submitted[0].section.DB(), *domainInfo.Domain)
+}
+
+// applyBatchResult 用记录列表中已生效的记录更新缓存, 返回尚未生效的记录
+func applyBatchResult(domainInfo *dnspod.DomainInfo, submitted []pendingRecord, records []*dnspod.RecordListItem) []pendingRecord {
+	var pending []pendingRecord
+	used := make(map[uint64]bool)
+	for _, p := range submitted {
+		item := batchResultItem(p, records, used)
+		if item == nil {
+			pending = append(pending, p)
+			continue
+		}
+		used[*item.RecordId] = true
+		if p.record == nil && p.recordId == nil {
+			journalBatchCreate(domainInfo, p, item.RecordId)
+		}
+		cacheRecord(p.section, p.dnsType+"-"+p.remark, "DescribeRecordList", listItemInfo(item, domainInfo.DomainId))
+	}
+	return pending
+}
+
+// batchResultItem 列表中与批量修改或创建对应且已生效的记录. 未返回 Id 的新记录按内容匹配, 排除缓存中已有的记录
+func batchResultItem(p pendingRecord, records []*dnspod.RecordListItem, used map[uint64]bool) *dnspod.RecordListItem {
+	id := p.recordId
+	if p.record != nil {
+		id = p.record.Id
+	}
+	var cached map[uint64]bool
+	if id == nil {
+		cached = recordSetIds(p.section, p.dnsType+"-"+p.remark)
+	}
+	for _, item := range records {
+		if item.RecordId == nil || used[*item.RecordId] || stringValue(item.Value) != p.value {
+			continue
+		}
+		if id != nil {
+			if *item.RecordId == *id {
+				return item
+			}
+			continue
+		}
+		if stringValue(item.Name) == p.subDomain && stringValue(item.Type) == p.dnsType && stringValue(item.Remark) == recordRemark(p.remark) && !cached[*item.RecordId] {
+			return item
+		}
+	}
+	return nil
+}
+
+// batchRecordFailed 批量任务中单条记录是否失败
+func batchRecordFailed(status, errMsg *string) bool {
+	if errMsg != nil && *errMsg != "" {
+		return true
+	}
+	return status != nil && strings.HasPrefix(strings.ToLower(*status), "fail")
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/sha256"
+	"dnspod-ddns/db"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// version 构建时可通过 -ldflags "-X main.version=..." 注入
+var version string
+
+var versionOnce sync.Once
+
+// toolVersion 写入缓存的程序版本. 未注入时由主模块版本及依赖模块版本生成, 升级 SDK 后随之变化
+func toolVersion() string {
+	versionOnce.Do(func() {
+		if version != "" {
+			return
+		}
+		version = "dev"
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		h := sha256.New()
+		for _, dep := range info.Deps {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			fmt.Fprintf(h, "%s@%s\n", dep.Path, dep.Version)
+		}
+		version = info.Main.Version + "+" + hex.EncodeToString(h.Sum(nil))[:12]
+	})
+	return version
+}
+
+// cacheSchemaVersion 缓存结构版本, 修改缓存键或缓存内容格式时递增并在 cacheMigrations 中补充迁移
+const cacheSchemaVersion = 2
+
+var errStaleCache = errors.New("cache entry schema mismatch")
+
+// cacheEntry 缓存条目信封, 记录写入时间、来源接口及写入程序版本
+type cacheEntry struct {
+	Schema    int             `json:"schema"`
+	WrittenAt int64           `json:"writtenAt"`
+	Source    string          `json:"source"`
+	Tool      string          `json:"tool"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// cacheMeta 缓存根目录下的版本信息
+type cacheMeta struct {
+	Schema int    `json:"schema"`
+	Tool   string `json:"tool"`
+}
+
+// cacheMigrations[n] 将 schema n 的缓存升级到 n+1
+var cacheMigrations = map[int]func(*db.DB) error{
+	0: migrateCacheV0,
+	1: migrateCacheV1,
+}
+
+// 根目录下不属于接口数据的条目
+var cacheMetaItems = map[string]bool{"cacheTime": true, "schema": true, "orphans": true, "paused": true, "published": true, "disabled": true, "refresh": true}
+
+// refreshGuard 串行化缓存根目录 refresh 的读改写
+var refreshGuard sync.Mutex
+
+// markRefresh 缓存中的域名记录可能与 DNSPod 不一致, 下次运行时只刷新该域名
+func markRefresh(dbh *db.DB, domain string) {
+	refreshGuard.Lock()
+	defer refreshGuard.Unlock()
+	refresh := make(map[string]bool)
+	_ = dbh.Get(&refresh, "refresh")
+	refresh[domain] = true
+	_ = dbh.Put(refresh, "refresh")
+}
+
+// clearRefresh 域名的缓存已从记录列表刷新
+func clearRefresh(dbh *db.DB, domain string) {
+	refreshGuard.Lock()
+	defer refreshGuard.Unlock()
+	refresh := make(map[string]bool)
+	if dbh.Get(&refresh, "refresh") != nil || !refresh[domain] {
+		return
+	}
+	delete(refresh, domain)
+	_ = dbh.Put(refresh, "refresh")
+}
+
+// refreshPending 需要刷新缓存的域名
+func refreshPending(dbh *db.DB) map[string]bool {
+	refreshGuard.Lock()
+	defer refreshGuard.Unlock()
+	refresh := make(map[string]bool)
+	_ = dbh.Get(&refresh, "refresh")
+	return refresh
+}
+
+func cachePut(section *db.Section, id, source string, object interface{}) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	return section.Put(id, cacheEntry{
+		Schema:    cacheSchemaVersion,
+		WrittenAt: time.Now().Unix(),
+		Source:    source,
+		Tool:      toolVersion(),
+		Data:      data,
+	})
+}
+
+func cacheGet(section *db.Section, id string, object interface{}) error {
+	var entry cacheEntry
+	if err := section.Get(id, &entry); err != nil {
+		return err
+	}
+	if entry.Schema != cacheSchemaVersion {
+		return fmt.Errorf("%w: %s has schema %d", errStaleCache, id, entry.Schema)
+	}
+	return json.Unmarshal(entry.Data, object)
+}
+
+// checkCacheSchema 比较缓存与当前程序的版本: schema 较旧时逐级迁移, 无法迁移时清空缓存;
+// 程序版本变化(可能升级了 SDK)时强制本次从接口刷新缓存
+func checkCacheSchema(dbh *db.DB) error {
+	var meta cacheMeta
+	if err := dbh.Get(&meta, "schema"); err != nil {
+		// 无版本信息: 空缓存或 schema 0 (直接保存 SDK 结构体)
+		meta = cacheMeta{}
+		if len(dbh.List()) == 0 {
+			meta.Schema = cacheSchemaVersion
+		}
+	}
+	for meta.Schema < cacheSchemaVersion {
+		migrate, ok := cacheMigrations[meta.Schema]
+		if !ok {
+			break
+		}
+		fmt.Printf("[%s] migrating cache schema %d -> %d\n", time.Now().Format("2006-01-02 15:04:05"), meta.Schema, meta.Schema+1)
+		if err := migrate(dbh); err != nil {
+			return err
+		}
+		meta.Schema++
+	}
+	if meta.Schema != cacheSchemaVersion {
+		fmt.Printf("[%s] cache schema %d not supported, cleaning cache\n", time.Now().Format("2006-01-02 15:04:05"), meta.Schema)
+		if err := cleanCache(dbh); err != nil {
+			return err
+		}
+		meta.Tool = toolVersion()
+	}
+	if meta.Tool != toolVersion() {
+		fmt.Printf("[%s] cache written by %s, running %s, forcing refresh\n", time.Now().Format("2006-01-02 15:04:05"), meta.Tool, toolVersion())
+		if err := dbh.Put(0, "cacheTime"); err != nil {
+			return err
+		}
+	}
+	return dbh.Put(cacheMeta{Schema: cacheSchemaVersion, Tool: toolVersion()}, "schema")
+}
+
+// cleanCache 清除接口数据, 保留根目录下的用户状态(停用、孤立记录等)
+func cleanCache(dbh *db.DB) error {
+	for _, rec := range dbh.List() {
+		if rec.Subsection {
+			if err := dbh.Clean(rec.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if cacheMetaItems[rec.Name] {
+			continue
+		}
+		if err := rec.Remove(); err != nil {
+			return err
+		}
+	}
+	return dbh.Put(0, "cacheTime")
+}
+
+// migrateCacheV0 将直接保存的 SDK 结构体包装为 cacheEntry
+func migrateCacheV0(dbh *db.DB) error {
+	return walkCache(dbh, nil, func(sections []string, rec db.Record) error {
+		if len(sections) == 0 && cacheMetaItems[rec.Name] {
+			return nil
+		}
+		var raw json.RawMessage
+		if err := rec.Get(&raw); err != nil {
+			return err
+		}
+		source := "DescribeRecord"
+		if len(sections) == 0 {
+			source = "DescribeDomain"
+		}
+		return rec.Update(cacheEntry{Schema: 1, WrittenAt: time.Now().Unix(), Source: source, Tool: "legacy", Data: raw})
+	})
+}
+
+// migrateCacheV1 记录缓存由单条 RecordInfo 改为记录集合
+func migrateCacheV1(dbh *db.DB) error {
+	return walkCache(dbh, nil, func(sections []string, rec db.Record) error {
+		if len(sections) != 2 {
+			return nil
+		}
+		var entry cacheEntry
+		if err := rec.Get(&entry); err != nil {
+			return err
+		}
+		entry.Schema = 2
+		entry.Data = append(append(json.RawMessage("["), entry.Data...), ']')
+		return rec.Update(entry)
+	})
+}
+
+func walkCache(dbh *db.DB, sections []string, fn func([]string, db.Record) error) error {
+	for _, rec := range dbh.List(sections...) {
+		if rec.Subsection {
+			sub := append(append([]string(nil), sections...), rec.Name)
+			if err := walkCache(dbh, sub, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(sections, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package db
+
+// Entry is a single item or subsection inside a section
+type Entry struct {
+	Name       string
+	Subsection bool
+}
+
+// Change of an entry reported by a Watch
+type Change struct {
+	Entry
+	Section []string
+	Event   Event
+}
+
+// Watch delivers changes of one section. Events channel is closed after Close
+type Watch interface {
+	Events() <-chan Change
+	Close() error
+}
+
+// Backend is a storage engine behind DB. Items are addressed by section path
+// and id and stored as already encoded content.
+type Backend interface {
+	// Get raw content of item. Missing item reports error matching os.ErrNotExist
+	Get(sections []string, id string) ([]byte, error)
+	// Put or replace raw content of item, creating sections as needed
+	Put(sections []string, id string, data []byte) error
+	// Remove single item
+	Remove(sections []string, id string) error
+	// Clean removes section with all items and subsections
+	Clean(sections []string) error
+	// List items and subsections of section. Missing section is empty
+	List(sections []string) ([]Entry, error)
+	// Watch changes of items and subsections of section (not nested ones)
+	Watch(sections []string) (Watch, error)
+	// Close releases backend resources
+	Close() error
+}
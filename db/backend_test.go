@@ -0,0 +1,134 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func backends(t *testing.T) map[string]Backend {
+	dir := t.TempDir()
+	bb, err := NewBoltBackend(filepath.Join(dir, "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = bb.Close() })
+	return map[string]Backend{
+		"file": &FileBackend{Root: filepath.Join(dir, "cache")},
+		"bolt": bb,
+	}
+}
+
+func sortedEntries(t *testing.T, b Backend, sections ...string) []Entry {
+	entries, err := b.List(sections)
+	if err != nil {
+		t.Fatalf("List(%v): %v", sections, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+func TestBackend(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, b Backend)
+	}{
+		{"missing item", func(t *testing.T, b Backend) {
+			if _, err := b.Get([]string{"example.com"}, "www"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Get missing = %v, want os.ErrNotExist", err)
+			}
+			if err := b.Remove(nil, "missing"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Remove missing = %v, want os.ErrNotExist", err)
+			}
+			if entries := sortedEntries(t, b, "missing"); len(entries) != 0 {
+				t.Errorf("List missing = %v, want empty", entries)
+			}
+		}},
+		{"put and get", func(t *testing.T, b Backend) {
+			sections := []string{"example.com", "www"}
+			for _, data := range []string{`{"v":1}`, `{"v":2}`} {
+				if err := b.Put(sections, "A-telecom", []byte(data)); err != nil {
+					t.Fatal(err)
+				}
+				got, err := b.Get(sections, "A-telecom")
+				if err != nil || string(got) != data {
+					t.Errorf("Get = %s, %v, want %s", got, err, data)
+				}
+			}
+		}},
+		{"escaped names", func(t *testing.T, b Backend) {
+			sections := []string{"example.com", "*.lab#telecom"}
+			if err := b.Put(sections, "a/b c", []byte("1")); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := b.Get(sections, "a/b c"); err != nil || string(got) != "1" {
+				t.Errorf("Get = %s, %v", got, err)
+			}
+			want := []Entry{{Name: "*.lab#telecom", Subsection: true}}
+			if got := sortedEntries(t, b, "example.com"); !reflect.DeepEqual(got, want) {
+				t.Errorf("List = %v, want %v", got, want)
+			}
+		}},
+		{"list items and subsections", func(t *testing.T, b Backend) {
+			_ = b.Put(nil, "cacheTime", []byte("1"))
+			_ = b.Put([]string{"example.com"}, "info", []byte("1"))
+			_ = b.Put([]string{"example.com", "www"}, "A-telecom", []byte("1"))
+			want := []Entry{{Name: "cacheTime"}, {Name: "example.com", Subsection: true}}
+			if got := sortedEntries(t, b); !reflect.DeepEqual(got, want) {
+				t.Errorf("List root = %v, want %v", got, want)
+			}
+			want = []Entry{{Name: "info"}, {Name: "www", Subsection: true}}
+			if got := sortedEntries(t, b, "example.com"); !reflect.DeepEqual(got, want) {
+				t.Errorf("List section = %v, want %v", got, want)
+			}
+		}},
+		{"remove", func(t *testing.T, b Backend) {
+			_ = b.Put(nil, "a", []byte("1"))
+			_ = b.Put(nil, "b", []byte("1"))
+			if err := b.Remove(nil, "a"); err != nil {
+				t.Fatal(err)
+			}
+			want := []Entry{{Name: "b"}}
+			if got := sortedEntries(t, b); !reflect.DeepEqual(got, want) {
+				t.Errorf("List = %v, want %v", got, want)
+			}
+		}},
+		{"clean section", func(t *testing.T, b Backend) {
+			_ = b.Put(nil, "paused", []byte("1"))
+			_ = b.Put([]string{"example.com", "www"}, "A-telecom", []byte("1"))
+			_ = b.Put([]string{"example.net"}, "info", []byte("1"))
+			if err := b.Clean([]string{"example.com"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Clean([]string{"missing"}); err != nil {
+				t.Errorf("Clean missing = %v", err)
+			}
+			want := []Entry{{Name: "example.net", Subsection: true}, {Name: "paused"}}
+			if got := sortedEntries(t, b); !reflect.DeepEqual(got, want) {
+				t.Errorf("List = %v, want %v", got, want)
+			}
+		}},
+		{"clean root", func(t *testing.T, b Backend) {
+			_ = b.Put(nil, "paused", []byte("1"))
+			_ = b.Put([]string{"example.com"}, "info", []byte("1"))
+			if err := b.Clean(nil); err != nil {
+				t.Fatal(err)
+			}
+			if got := sortedEntries(t, b); len(got) != 0 {
+				t.Errorf("List = %v, want empty", got)
+			}
+			if err := b.Put(nil, "cacheTime", []byte("1")); err != nil {
+				t.Errorf("Put after Clean = %v", err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		for name, b := range backends(t) {
+			b := b
+			t.Run(tt.name+"/"+name, func(t *testing.T) { tt.run(t, b) })
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltRoot = []byte("root")
+
+// BoltBackend keeps whole database in a single bbolt file.
+// Sections are nested buckets, items are keys with format extension, so the
+// layout mirrors FileBackend.
+type BoltBackend struct {
+	bolt     *bolt.DB
+	guard    sync.Mutex
+	watchers map[*boltWatch]struct{}
+}
+
+// OpenBolt opens (or creates) bbolt file and returns database on top of it
+func OpenBolt(location string) (*DB, error) {
+	b, err := NewBoltBackend(location)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{Root: location, Backend: b}, nil
+}
+
+// NewBoltBackend opens (or creates) bbolt file
+func NewBoltBackend(location string) (*BoltBackend, error) {
+	bdb, err := bolt.Open(location, 0644, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltRoot)
+		return err
+	})
+	if err != nil {
+		_ = bdb.Close()
+		return nil, err
+	}
+	return &BoltBackend{bolt: bdb, watchers: make(map[*boltWatch]struct{})}, nil
+}
+
+// bucket of section or nil if any level is missing
+func bucket(tx *bolt.Tx, sections []string) *bolt.Bucket {
+	b := tx.Bucket(boltRoot)
+	for _, name := range sections {
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket([]byte(name))
+	}
+	return b
+}
+
+func createBucket(tx *bolt.Tx, sections []string) (*bolt.Bucket, error) {
+	b := tx.Bucket(boltRoot)
+	for _, name := range sections {
+		var err error
+		b, err = b.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func notExist(sections []string, id string) error {
+	return &os.PathError{Op: "get", Path: strings.Join(append(sections, id), "/"), Err: os.ErrNotExist}
+}
+
+// Get value of item key
+func (bb *BoltBackend) Get(sections []string, id string) ([]byte, error) {
+	var data []byte
+	err := bb.bolt.View(func(tx *bolt.Tx) error {
+		b := bucket(tx, sections)
+		if b == nil {
+			return notExist(sections, id)
+		}
+		v := b.Get([]byte(id + formatExtension))
+		if v == nil {
+			return notExist(sections, id)
+		}
+		data = append([]byte(nil), v...)
+		return nil
+	})
+	return data, err
+}
+
+// Put value to item key
+func (bb *BoltBackend) Put(sections []string, id string, data []byte) error {
+	ev := Update
+	err := bb.bolt.Update(func(tx *bolt.Tx) error {
+		b, err := createBucket(tx, sections)
+		if err != nil {
+			return err
+		}
+		key := []byte(id + formatExtension)
+		if b.Get(key) == nil {
+			ev = Create
+		}
+		return b.Put(key, data)
+	})
+	if err == nil {
+		bb.emit(Change{Entry: Entry{Name: id}, Section: sections, Event: ev})
+	}
+	return err
+}
+
+// Remove item key
+func (bb *BoltBackend) Remove(sections []string, id string) error {
+	err := bb.bolt.Update(func(tx *bolt.Tx) error {
+		b := bucket(tx, sections)
+		key := []byte(id + formatExtension)
+		if b == nil || b.Get(key) == nil {
+			return notExist(sections, id)
+		}
+		return b.Delete(key)
+	})
+	if err == nil {
+		bb.emit(Change{Entry: Entry{Name: id}, Section: sections, Event: Remove})
+	}
+	return err
+}
+
+// Clean removes section bucket. Root section is emptied instead
+func (bb *BoltBackend) Clean(sections []string) error {
+	err := bb.bolt.Update(func(tx *bolt.Tx) error {
+		if len(sections) == 0 {
+			if err := tx.DeleteBucket(boltRoot); err != nil {
+				return err
+			}
+			_, err := tx.CreateBucket(boltRoot)
+			return err
+		}
+		parent := bucket(tx, sections[:len(sections)-1])
+		if parent == nil {
+			return nil
+		}
+		err := parent.DeleteBucket([]byte(sections[len(sections)-1]))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+	if err == nil && len(sections) > 0 {
+		last := len(sections) - 1
+		bb.emit(Change{Entry: Entry{Name: sections[last], Subsection: true}, Section: sections[:last], Event: Remove})
+	}
+	return err
+}
+
+// List keys and nested buckets of section bucket
+func (bb *BoltBackend) List(sections []string) ([]Entry, error) {
+	var ans []Entry
+	err := bb.bolt.View(func(tx *bolt.Tx) error {
+		b := bucket(tx, sections)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			ent := Entry{Name: string(k), Subsection: v == nil}
+			if !ent.Subsection {
+				ent.Name = strings.TrimSuffix(ent.Name, formatExtension)
+			}
+			ans = append(ans, ent)
+			return nil
+		})
+	})
+	return ans, err
+}
+
+// Watch changes made through this backend. Changes made by other processes
+// are not reported.
+func (bb *BoltBackend) Watch(sections []string) (Watch, error) {
+	w := &boltWatch{
+		backend:  bb,
+		sections: append([]string(nil), sections...),
+		events:   make(chan Change, 16),
+	}
+	bb.guard.Lock()
+	bb.watchers[w] = struct{}{}
+	bb.guard.Unlock()
+	return w, nil
+}
+
+// Close bbolt file and stops all watches
+func (bb *BoltBackend) Close() error {
+	bb.guard.Lock()
+	for w := range bb.watchers {
+		delete(bb.watchers, w)
+		close(w.events)
+	}
+	bb.guard.Unlock()
+	return bb.bolt.Close()
+}
+
+// emit change to watchers of its section. Writers are never blocked: changes
+// are dropped for watchers which do not keep up
+func (bb *BoltBackend) emit(ch Change) {
+	ch.Section = append([]string(nil), ch.Section...)
+	bb.guard.Lock()
+	defer bb.guard.Unlock()
+	for w := range bb.watchers {
+		if sameSection(w.sections, ch.Section) {
+			select {
+			case w.events <- ch:
+			default:
+			}
+		}
+	}
+}
+
+func sameSection(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type boltWatch struct {
+	backend  *BoltBackend
+	sections []string
+	events   chan Change
+}
+
+func (w *boltWatch) Events() <-chan Change {
+	return w.events
+}
+
+func (w *boltWatch) Close() error {
+	w.backend.guard.Lock()
+	defer w.backend.guard.Unlock()
+	if _, ok := w.backend.watchers[w]; !ok {
+		return fmt.Errorf("watch already closed")
+	}
+	delete(w.backend.watchers, w)
+	close(w.events)
+	return nil
+}
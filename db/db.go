@@ -7,15 +7,7 @@ package db
 import (
 	"encoding/json"
 	"errors"
-	"io/ioutil"
-	"net/url"
-	"os"
-	"path"
-	"path/filepath"
-	"strings"
 	"sync"
-
-	"github.com/fsnotify/fsnotify"
 )
 
 const formatExtension = ".json"
@@ -42,13 +34,15 @@ func (ev Event) String() string {
 	return "Unknown event"
 }
 
-// DB is file based database.
+// DB is file based database by default.
 // Sections - level of folders.
 // Items - JSON files.
 // Names automatically url-encoded.
+// Set Backend to keep the same layout in another storage.
 type DB struct {
-	Root  string
-	guard sync.RWMutex
+	Root    string
+	Backend Backend
+	guard   sync.RWMutex
 }
 
 func (db *DB) lockReadDB() {
@@ -71,14 +65,21 @@ func (db *DB) unlockWriteDB() {
 	db.guard.Unlock()
 }
 
+func (db *DB) backend() Backend {
+	if db.Backend == nil {
+		return &FileBackend{Root: db.Root}
+	}
+	return db.Backend
+}
+
+// Close underlying backend
+func (db *DB) Close() error {
+	return db.backend().Close()
+}
+
 // DirLocation - get real directory (relative to Root) location of specified sections
 func (db *DB) DirLocation(sectionPath ...string) string {
-	escaped := make([]string, len(sectionPath)+1)
-	escaped[0] = db.Root
-	for i := 0; i < len(sectionPath); i++ {
-		escaped[1+i] = url.QueryEscape(sectionPath[i])
-	}
-	return path.Join(escaped...)
+	return (&FileBackend{Root: db.Root}).DirLocation(sectionPath...)
 }
 
 // FileLocation - get real file (relative to Root) location of specified sections with format extension
@@ -96,38 +97,33 @@ func (db *DB) Section(sectionPath ...string) *Section {
 func (db *DB) Put(object interface{}, id string, sectionPath ...string) error {
 	db.lockWriteDB()
 	defer db.unlockWriteDB()
-	location := db.FileLocation(append(sectionPath, id)...)
-	if err := os.MkdirAll(path.Dir(location), 0755); err != nil {
-		return err
-	}
 	data, err := json.MarshalIndent(object, "", "    ")
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(location, data, 0755)
+	return db.backend().Put(sectionPath, id, data)
 }
 
-// RemoveItem - removes saved item from filesystem
+// RemoveItem - removes saved item from storage
 func (db *DB) RemoveItem(id string, sectionPath ...string) error {
 	db.lockWriteDB()
 	defer db.unlockWriteDB()
-	return os.Remove(db.FileLocation(append(sectionPath, id)...))
+	return db.backend().Remove(sectionPath, id)
 }
 
 // Clean sectoions - remove all subsections and saved items
 func (db *DB) Clean(sectionPath ...string) error {
 	db.lockWriteDB()
 	defer db.unlockWriteDB()
-	return os.RemoveAll(db.DirLocation(sectionPath...))
+	return db.backend().Clean(sectionPath)
 }
 
-// Get signle item from filesystem and unmarshall it by JSON decoder.
+// Get signle item from storage and unmarshall it by JSON decoder.
 // Decoder may be changed in future releases
 func (db *DB) Get(destination interface{}, id string, sectionPath ...string) error {
 	db.lockReadDB()
 	defer db.unlockReadDB()
-	location := db.FileLocation(append(sectionPath, id)...)
-	data, err := ioutil.ReadFile(location)
+	data, err := db.backend().Get(sectionPath, id)
 	if err != nil {
 		return err
 	}
@@ -139,24 +135,16 @@ func (db *DB) List(sectionPath ...string) []Record {
 	db.lockReadDB()
 	defer db.unlockReadDB()
 	var ans []Record
-	locations := db.DirLocation(sectionPath...)
-	infos, err := ioutil.ReadDir(locations)
+	entries, err := db.backend().List(sectionPath)
 	if err != nil {
 		return ans
 	}
-	for _, info := range infos {
+	for _, ent := range entries {
 		rec := Record{}
-		name, _ := url.QueryUnescape(info.Name())
 		rec.db = db
-		rec.Subsection = info.IsDir()
-		rec.Name, _ = url.QueryUnescape(name)
+		rec.Subsection = ent.Subsection
+		rec.Name = ent.Name
 		rec.Section = sectionPath
-		if !rec.Subsection {
-			idx := strings.LastIndex(rec.Name, ".")
-			if idx >= 0 {
-				rec.Name = rec.Name[:idx]
-			}
-		}
 		ans = append(ans, rec)
 	}
 	return ans
@@ -167,7 +155,7 @@ func (db *DB) List(sectionPath ...string) []Record {
 type Section struct {
 	db       *DB
 	sections []string
-	watcher  *fsnotify.Watcher
+	watch    Watch
 	notify   chan RecordEvent
 }
 
@@ -176,6 +164,11 @@ func (s *Section) Notification() <-chan RecordEvent {
 	return s.notify
 }
 
+// DB the section belongs to
+func (s *Section) DB() *DB {
+	return s.db
+}
+
 // Location in real filesystem
 func (s *Section) Location() string {
 	return s.db.DirLocation(s.sections...)
@@ -192,52 +185,23 @@ func (s *Section) RemoveItem(id string) error {
 }
 
 // StartNotification - create notification channel and starts listen
-// to any file changes in current section (not in subsections).
+// to any changes in current section (not in subsections).
 func (s *Section) StartNotification() error {
 	var err error
-	err = os.MkdirAll(s.Location(), 0755)
-	if err != nil {
-		return err
-	}
-	s.watcher, err = fsnotify.NewWatcher()
-	if err != nil {
-		return err
-	}
-	err = s.watcher.Add(s.Location())
+	s.watch, err = s.db.backend().Watch(s.sections)
 	if err != nil {
 		return err
 	}
 	s.notify = make(chan RecordEvent)
 	go func() {
 		defer close(s.notify)
-		for event := range s.watcher.Events {
-
-			relative, err := filepath.Rel(s.db.Root, event.Name)
-			if err != nil {
-				continue
-			}
+		for ch := range s.watch.Events() {
 			rec := RecordEvent{}
 			rec.db = s.db
-			rec.Subsection = !strings.HasSuffix(event.Name, formatExtension)
-			rec.Name, _ = url.QueryUnescape(path.Base(relative))
-			rec.Section = strings.Split(path.Dir(relative), string(os.PathSeparator))
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				rec.Event = Update
-			} else if event.Op&fsnotify.Create == fsnotify.Create {
-				rec.Event = Create
-			} else if event.Op&fsnotify.Remove == fsnotify.Remove {
-				rec.Event = Remove
-			} else if event.Op&fsnotify.Chmod == fsnotify.Chmod {
-				continue
-			} else {
-				rec.Event = Update
-			}
-			if !rec.Subsection {
-				idx := strings.LastIndex(rec.Name, ".")
-				if idx >= 0 {
-					rec.Name = rec.Name[:idx]
-				}
-			}
+			rec.Subsection = ch.Subsection
+			rec.Name = ch.Name
+			rec.Section = ch.Section
+			rec.Event = ch.Event
 			s.notify <- rec
 		}
 	}()
@@ -246,8 +210,8 @@ func (s *Section) StartNotification() error {
 
 // StopNotification - stops notification (if it created)
 func (s *Section) StopNotification() {
-	if s.watcher != nil {
-		s.watcher.Close()
+	if s.watch != nil {
+		s.watch.Close()
 	}
 }
 
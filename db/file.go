@@ -0,0 +1,154 @@
+package db
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// FileBackend keeps sections as folders and items as JSON files under Root.
+// Names automatically url-encoded.
+type FileBackend struct {
+	Root string
+}
+
+// DirLocation - get real directory (relative to Root) location of specified sections
+func (fb *FileBackend) DirLocation(sectionPath ...string) string {
+	escaped := make([]string, len(sectionPath)+1)
+	escaped[0] = fb.Root
+	for i := 0; i < len(sectionPath); i++ {
+		escaped[1+i] = url.QueryEscape(sectionPath[i])
+	}
+	return path.Join(escaped...)
+}
+
+// FileLocation - get real file (relative to Root) location of specified sections with format extension
+// This function doesn't check file
+func (fb *FileBackend) FileLocation(sectionPath ...string) string {
+	return fb.DirLocation(sectionPath...) + formatExtension
+}
+
+// Get content of item file
+func (fb *FileBackend) Get(sections []string, id string) ([]byte, error) {
+	return ioutil.ReadFile(fb.FileLocation(append(sections, id)...))
+}
+
+// Put content to item file
+func (fb *FileBackend) Put(sections []string, id string, data []byte) error {
+	location := fb.FileLocation(append(sections, id)...)
+	if err := os.MkdirAll(path.Dir(location), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(location, data, 0755)
+}
+
+// Remove item file
+func (fb *FileBackend) Remove(sections []string, id string) error {
+	return os.Remove(fb.FileLocation(append(sections, id)...))
+}
+
+// Clean section folder
+func (fb *FileBackend) Clean(sections []string) error {
+	return os.RemoveAll(fb.DirLocation(sections...))
+}
+
+// List files and folders of section folder
+func (fb *FileBackend) List(sections []string) ([]Entry, error) {
+	infos, err := ioutil.ReadDir(fb.DirLocation(sections...))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ans []Entry
+	for _, info := range infos {
+		name, _ := url.QueryUnescape(info.Name())
+		ent := Entry{Subsection: info.IsDir()}
+		ent.Name, _ = url.QueryUnescape(name)
+		if !ent.Subsection {
+			ent.Name = trimExtension(ent.Name)
+		}
+		ans = append(ans, ent)
+	}
+	return ans, nil
+}
+
+// Watch section folder by fsnotify
+func (fb *FileBackend) Watch(sections []string) (Watch, error) {
+	location := fb.DirLocation(sections...)
+	err := os.MkdirAll(location, 0755)
+	if err != nil {
+		return nil, err
+	}
+	w := &fileWatch{events: make(chan Change)}
+	w.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	err = w.watcher.Add(location)
+	if err != nil {
+		_ = w.watcher.Close()
+		return nil, err
+	}
+	go func() {
+		defer close(w.events)
+		for event := range w.watcher.Events {
+			relative, err := filepath.Rel(fb.Root, event.Name)
+			if err != nil {
+				continue
+			}
+			ch := Change{}
+			ch.Subsection = !strings.HasSuffix(event.Name, formatExtension)
+			ch.Name, _ = url.QueryUnescape(path.Base(relative))
+			ch.Section = strings.Split(path.Dir(relative), string(os.PathSeparator))
+			if event.Op&fsnotify.Write == fsnotify.Write {
+				ch.Event = Update
+			} else if event.Op&fsnotify.Create == fsnotify.Create {
+				ch.Event = Create
+			} else if event.Op&fsnotify.Remove == fsnotify.Remove {
+				ch.Event = Remove
+			} else if event.Op&fsnotify.Chmod == fsnotify.Chmod {
+				continue
+			} else {
+				ch.Event = Update
+			}
+			if !ch.Subsection {
+				ch.Name = trimExtension(ch.Name)
+			}
+			w.events <- ch
+		}
+	}()
+	return w, nil
+}
+
+// Close does nothing: files are not kept open
+func (fb *FileBackend) Close() error {
+	return nil
+}
+
+type fileWatch struct {
+	watcher *fsnotify.Watcher
+	events  chan Change
+}
+
+func (w *fileWatch) Events() <-chan Change {
+	return w.events
+}
+
+func (w *fileWatch) Close() error {
+	return w.watcher.Close()
+}
+
+func trimExtension(name string) string {
+	idx := strings.LastIndex(name, ".")
+	if idx >= 0 {
+		return name[:idx]
+	}
+	return name
+}
@@ -0,0 +1,38 @@
+package db
+
+// Copy all items and subsections from src to dst as is (without decoding).
+// Used to migrate between backends.
+func Copy(dst, src *DB) error {
+	return copySection(dst, src, nil)
+}
+
+func copySection(dst, src *DB, sections []string) error {
+	src.lockReadDB()
+	entries, err := src.backend().List(sections)
+	src.unlockReadDB()
+	if err != nil {
+		return err
+	}
+	for _, ent := range entries {
+		if ent.Subsection {
+			sub := append(append([]string(nil), sections...), ent.Name)
+			if err := copySection(dst, src, sub); err != nil {
+				return err
+			}
+			continue
+		}
+		src.lockReadDB()
+		data, err := src.backend().Get(sections, ent.Name)
+		src.unlockReadDB()
+		if err != nil {
+			return err
+		}
+		dst.lockWriteDB()
+		err = dst.backend().Put(sections, ent.Name, data)
+		dst.unlockWriteDB()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// DomainSelector 按名称通配符、分组或关键字从账号中选择域名, 选中的域名使用 subdomains 配置.
+// domains 中已配置的域名不受影响
+type DomainSelector struct {
+	Pattern    string   `json:"pattern"`
+	GroupId    int64    `json:"groupId"`
+	Keyword    string   `json:"keyword"`
+	Subdomains []string `json:"subdomains"`
+}
+
+// subdomainPattern 以 ~ 开头的子域名为通配符, 匹配已有的 A/AAAA 记录, 如 "~*.lab";
+// "~*#telecom" 即名称为 telecom 的所有记录
+const subdomainPattern = "~"
+
+func isPattern(subDomain string) bool {
+	_, sub := parseSubdomain(subDomain)
+	return strings.HasPrefix(sub, subdomainPattern)
+}
+
+func hasPatterns(subDomains []string) bool {
+	for _, s := range subDomains {
+		if isPattern(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// patternMatches 子域名是否与通配符匹配
+func patternMatches(pattern, subDomain string) bool {
+	ok, err := path.Match(strings.TrimPrefix(pattern, subdomainPattern), subDomain)
+	return err == nil && ok
+}
+
+// discoverDomains 将 domainSelect 选中的域名加入 domains
+func discoverDomains(client *dnspod.Client) {
+	for _, selector := range config.DomainSelect {
+		domains, err := listDomains(selector, client)
+		if err != nil {
+			fmt.Printf("DescribeDomainList failed: %s\n", err)
+			continue
+		}
+		for _, domain := range domains {
+			if selector.Pattern != "" {
+				if ok, err := path.Match(selector.Pattern, domain); err != nil || !ok {
+					continue
+				}
+			}
+			if _, ok := config.Domains[domain]; ok {
+				continue
+			}
+			if config.Domains == nil {
+				config.Domains = make(map[string][]string)
+			}
+			fmt.Printf("[%s] discovered domain %s\n", time.Now().Format("2006-01-02 15:04:05"), domain)
+			config.Domains[domain] = selector.Subdomains
+		}
+	}
+}
+
+// listDomains 分页获取账号中的域名
+func listDomains(selector DomainSelector, client *dnspod.Client) ([]string, error) {
+	var domains []string
+	var offset int64
+	for {
+		request := dnspod.NewDescribeDomainListRequest()
+		var limit int64 = 3000
+		pageOffset := offset
+		request.Offset = &pageOffset
+		request.Limit = &limit
+		if selector.GroupId != 0 {
+			groupId := selector.GroupId
+			request.GroupId = &groupId
+		}
+		if selector.Keyword != "" {
+			keyword := selector.Keyword
+			request.Keyword = &keyword
+		}
+		<-rateLimiter
+		response, err := client.DescribeDomainList(request)
+		if err != nil {
+			return nil, err
+		}
+		if response == nil || response.Response == nil {
+			return domains, nil
+		}
+		for _, d := range response.Response.DomainList {
+			if d.Name != nil {
+				domains = append(domains, *d.Name)
+			}
+		}
+		page := int64(len(response.Response.DomainList))
+		offset += page
+		if page < limit {
+			return domains, nil
+		}
+	}
+}
+
+// expandSubdomains 将通配符展开为匹配的记录名称, 保留原有的 #名称 后缀.
+// 只展开到本程序管理的记录或 adopt 允许接管的子域名, 不触碰手工维护的记录
+func expandSubdomains(domain string, subDomains []string, records []*dnspod.RecordListItem) []string {
+	var expanded []string
+	seen := make(map[string]bool)
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			expanded = append(expanded, s)
+		}
+	}
+	for _, s := range subDomains {
+		if !isPattern(s) {
+			add(s)
+			continue
+		}
+		rmk, pattern := parseSubdomain(s)
+		for _, record := range records {
+			if *record.Type != "A" && *record.Type != "AAAA" || !patternMatches(pattern, *record.Name) {
+				continue
+			}
+			name, ok := ownedRemark(*record.Remark)
+			if rmk != "" {
+				// 只匹配该名称的记录, 未加前缀的同名记录须允许接管
+				if !(ok && name == rmk) && !(*record.Remark == rmk && adoptable(domain, *record.Name)) {
+					continue
+				}
+				add(*record.Name + "#" + rmk)
+				continue
+			}
+			if !ok && !adoptable(domain, *record.Name) {
+				continue
+			}
+			add(*record.Name)
+		}
+	}
+	return expanded
+}
+
+// subdomainNames 子域名配置中的记录名称
+func subdomainNames(subDomains []string) map[string]bool {
+	names := make(map[string]bool)
+	for _, s := range subDomains {
+		_, sub := parseSubdomain(s)
+		names[sub] = true
+	}
+	return names
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+func TestExpandSubdomains(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+
+	remarked := func(name, recordType, remark string) *dnspod.RecordListItem {
+		r := listItem(0, name, recordType, "192.0.2.1")
+		r.Remark = &remark
+		return r
+	}
+	records := []*dnspod.RecordListItem{
+		remarked("a.lab", "A", "ddns-telecom"),
+		remarked("b.lab", "AAAA", "ddns-unicom"),
+		remarked("c.lab", "A", "manual"),
+		remarked("d.lab", "A", ""),
+		remarked("e.lab", "CNAME", "ddns-telecom"),
+		remarked("a.lab", "AAAA", "ddns-telecom"),
+		remarked("www", "A", "ddns-telecom"),
+		remarked("f.lab", "A", "telecom"),
+	}
+	tests := []struct {
+		name       string
+		adopt      []string
+		subDomains []string
+		want       []string
+	}{
+		{"plain subdomains kept", nil, []string{"www", "@#telecom"}, []string{"www", "@#telecom"}},
+		{"owned records only", nil, []string{"~*.lab"}, []string{"a.lab", "b.lab"}},
+		{"adoptable records", []string{"c.lab", "d.lab", "f.lab"}, []string{"~*.lab"}, []string{"a.lab", "b.lab", "c.lab", "d.lab", "f.lab"}},
+		{"by remark", nil, []string{"~*#telecom"}, []string{"a.lab#telecom", "www#telecom"}},
+		{"by remark with pattern", nil, []string{"~*.lab#unicom"}, []string{"b.lab#unicom"}},
+		{"bare remark not adoptable", nil, []string{"~f.*#telecom"}, nil},
+		{"bare remark adoptable", []string{"f.lab"}, []string{"~f.*#telecom"}, []string{"f.lab#telecom"}},
+		{"no match", nil, []string{"~*.test"}, nil},
+		{"mixed and deduplicated", nil, []string{"www", "~*"}, []string{"www", "a.lab", "b.lab"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config = Config{RemarkPrefix: "ddns-", Adopt: map[string][]string{"example.com": tt.adopt}}
+			got := expandSubdomains("example.com", tt.subDomains, records)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandSubdomains(%v) = %v, want %v", tt.subDomains, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tencentErrors "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// domainMissing 错误是否表示账号中没有该域名
+func domainMissing(err error) bool {
+	var sdkErr *tencentErrors.TencentCloudSDKError
+	if !errors.As(err, &sdkErr) {
+		return false
+	}
+	return strings.Contains(sdkErr.Code, "DomainNotExist") || strings.Contains(sdkErr.Code, "NoDataOfDomain")
+}
+
+// describeDomain 获取域名信息. 域名不存在且开启 createDomains 时先创建域名并打印需在注册商处设置的 NS
+func describeDomain(domain string, client *dnspod.Client) (*dnspod.DomainInfo, error) {
+	info, err := getDomainInfo(domain, client)
+	if err == nil || !domainMissing(err) || !config.CreateDomains {
+		return info, err
+	}
+	fmt.Printf("[%s] domain %s not found, creating\n", time.Now().Format("2006-01-02 15:04:05"), domain)
+	request := dnspod.NewCreateDomainRequest()
+	request.Domain = &domain
+	<-rateLimiter
+	response, err := client.CreateDomain(request)
+	if err != nil {
+		markFailed()
+		return nil, err
+	}
+	if response != nil && response.Response != nil && response.Response.DomainInfo != nil {
+		var ns []string
+		for _, n := range response.Response.DomainInfo.GradeNsList {
+			if n != nil {
+				ns = append(ns, *n)
+			}
+		}
+		fmt.Printf("[%s] domain %s created, set NS at the registrar to: %s\n", time.Now().Format("2006-01-02 15:04:05"), domain, strings.Join(ns, " "))
+	}
+	return getDomainInfo(domain, client)
+}
+
+func getDomainInfo(domain string, client *dnspod.Client) (*dnspod.DomainInfo, error) {
+	describeDomainRequest := dnspod.NewDescribeDomainRequest()
+	describeDomainRequest.Domain = &domain
+	<-rateLimiter
+	describeDomainResponse, err := client.DescribeDomain(describeDomainRequest)
+	if err != nil {
+		return nil, err
+	}
+	if describeDomainResponse == nil || describeDomainResponse.Response == nil || describeDomainResponse.Response.DomainInfo == nil {
+		return nil, fmt.Errorf("empty DomainInfo returned: %v", describeDomainResponse)
+	}
+	return describeDomainResponse.Response.DomainInfo, nil
+}
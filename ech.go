@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// echCache 本次运行中已读取的 ECHConfigList, 路径 -> base64 值/错误
+var (
+	echCache = make(map[string]echEntry)
+	echGuard sync.Mutex
+)
+
+type echEntry struct {
+	value string
+	err   error
+}
+
+// loadEch 读取 echFile 配置的 ECHConfigList, 返回 ech SvcParam 使用的 base64 值.
+// 路径为目录时(反向代理的密钥轮换目录)使用其中最新且能解析的文件
+func loadEch(path string) (string, error) {
+	echGuard.Lock()
+	defer echGuard.Unlock()
+	if e, ok := echCache[path]; ok {
+		return e.value, e.err
+	}
+	value, err := readEchPath(path)
+	if err != nil {
+		fmt.Printf("[%s] read ech %s failed: %s\n", time.Now().Format("2006-01-02 15:04:05"), path, err)
+	}
+	echCache[path] = echEntry{value, err}
+	return value, err
+}
+
+func readEchPath(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return readEchFile(path)
+	}
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().After(files[j].ModTime()) })
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		// 目录中可能同时存放私钥, 不含 ECHConfigList 的文件跳过
+		if value, err := readEchFile(filepath.Join(path, f.Name())); err == nil {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("no ECHConfigList found in %s", path)
+}
+
+// readEchFile 支持 PEM(ECHCONFIG 块)、base64 文本及二进制格式的 ECHConfigList
+func readEchFile(name string) (string, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	var list []byte
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		for rest := data; ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type == "ECHCONFIG" {
+				list = block.Bytes
+				break
+			}
+		}
+		if list == nil {
+			return "", fmt.Errorf("no ECHCONFIG block in %s", name)
+		}
+	} else if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data))); err == nil {
+		list = decoded
+	} else {
+		list = data
+	}
+	if !validEchConfigList(list) {
+		return "", fmt.Errorf("invalid ECHConfigList in %s", name)
+	}
+	return base64.StdEncoding.EncodeToString(list), nil
+}
+
+// validEchConfigList 检查 ECHConfigList 的长度前缀及其中每个 ECHConfig 的长度
+func validEchConfigList(list []byte) bool {
+	if len(list) < 2 || int(list[0])<<8|int(list[1]) != len(list)-2 || len(list) == 2 {
+		return false
+	}
+	for rest := list[2:]; len(rest) > 0; {
+		// version(2) + length(2) + contents
+		if len(rest) < 4 {
+			return false
+		}
+		n := int(rest[2])<<8 | int(rest[3])
+		if len(rest) < 4+n {
+			return false
+		}
+		rest = rest[4+n:]
+	}
+	return true
+}
+
+// echUnavailable 子域名配置了 echFile 但本次读取失败, 此时沿用已发布的 ech
+func echUnavailable(domain, subDomain string) bool {
+	p := httpsParams(domain, subDomain)
+	if p.EchFile == "" {
+		return false
+	}
+	_, err := loadEch(p.EchFile)
+	return err != nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestValidEchConfigList(t *testing.T) {
+	tests := []struct {
+		name string
+		list []byte
+		want bool
+	}{
+		{"one config", []byte{0, 6, 0xfe, 0x0d, 0, 2, 0xaa, 0xbb}, true},
+		{"empty contents", []byte{0, 4, 0xfe, 0x0d, 0, 0}, true},
+		{"two configs", []byte{0, 11, 0xfe, 0x0d, 0, 1, 0xaa, 0xfe, 0x0d, 0, 2, 0xbb, 0xcc}, true},
+		{"nil", nil, false},
+		{"one byte", []byte{0}, false},
+		{"empty list", []byte{0, 0}, false},
+		{"list length too long", []byte{0, 7, 0xfe, 0x0d, 0, 2, 0xaa, 0xbb}, false},
+		{"list length too short", []byte{0, 5, 0xfe, 0x0d, 0, 2, 0xaa, 0xbb}, false},
+		{"truncated config header", []byte{0, 3, 0xfe, 0x0d, 0}, false},
+		{"config length overflow", []byte{0, 6, 0xfe, 0x0d, 0, 3, 0xaa, 0xbb}, false},
+		{"trailing bytes", []byte{0, 7, 0xfe, 0x0d, 0, 2, 0xaa, 0xbb, 0xcc}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validEchConfigList(tt.list); got != tt.want {
+				t.Errorf("validEchConfigList(%x) = %v, want %v", tt.list, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"dnspod-ddns/db"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// handleLostRecord 按 lostFamily 配置处理 IPv4/IPv6 地址已消失的托管记录集合
+func handleLostRecord(section *db.Section, subDomain, key string, domainInfo *dnspod.DomainInfo, client *dnspod.Client) {
+	set, _ := getRecordSet(section, key)
+	for _, record := range set {
+		if record.Id == nil || record.Enabled != nil && *record.Enabled == 0 {
+			continue
+		}
+		handleLostMember(section, subDomain, key, record, domainInfo, client)
+	}
+}
+
+func handleLostMember(section *db.Section, subDomain, key string, record *dnspod.RecordInfo, domainInfo *dnspod.DomainInfo, client *dnspod.Client) {
+	switch config.LostFamily {
+	case "disable":
+		fmt.Printf("[%s] %s.%s[%s] address lost, disabling %s\n", time.Now().Format("2006-01-02 15:04:05"), subDomain, *domainInfo.Domain, key, *record.Value)
+		disableRecord(section, key, record, domainInfo, client)
+	case "delete":
+		fmt.Printf("[%s] %s.%s[%s] address lost, deleting %s\n", time.Now().Format("2006-01-02 15:04:05"), subDomain, *domainInfo.Domain, key, *record.Value)
+		if err := deleteRecord(domainInfo.Domain, record, client); err != nil {
+			fmt.Printf("deleteRecord failed: %s\n", err)
+			return
+		}
+		uncacheRecord(section, key, *record.Id)
+	default:
+		fmt.Printf("[%s] %s.%s[%s] address lost, keeping %s\n", time.Now().Format("2006-01-02 15:04:05"), subDomain, *domainInfo.Domain, key, *record.Value)
+	}
+}
+
+// disabledGuard 串行化缓存根目录 disabled 的读改写
+var disabledGuard sync.Mutex
+
+func disabledKey(domain string, id uint64) string {
+	return domain + "/" + strconv.FormatUint(id, 10)
+}
+
+// markDisabled 在缓存根目录的 disabled 中记录或清除由本程序停用的记录
+func markDisabled(dbh *db.DB, domain string, id uint64, disabled bool) {
+	disabledGuard.Lock()
+	defer disabledGuard.Unlock()
+	marks := make(map[string]bool)
+	_ = dbh.Get(&marks, "disabled")
+	if disabled {
+		marks[disabledKey(domain, id)] = true
+	} else {
+		delete(marks, disabledKey(domain, id))
+	}
+	_ = dbh.Put(marks, "disabled")
+}
+
+// disabledByUs 记录是否由本程序停用, 手动停用的记录不自动启用
+func disabledByUs(dbh *db.DB, domain string, id uint64) bool {
+	disabledGuard.Lock()
+	defer disabledGuard.Unlock()
+	marks := make(map[string]bool)
+	_ = dbh.Get(&marks, "disabled")
+	return marks[disabledKey(domain, id)]
+}
+
+// disableRecord 停用记录并更新缓存
+func disableRecord(section *db.Section, key string, record *dnspod.RecordInfo, domainInfo *dnspod.DomainInfo, client *dnspod.Client) {
+	if err := modifyRecordStatus(domainInfo.Domain, record, "DISABLE", client); err != nil {
+		fmt.Printf("disable failed: %s\n", err)
+		return
+	}
+	markDisabled(section.DB(), *domainInfo.Domain, *record.Id, true)
+	var enabled uint64 = 0
+	record.Enabled = &enabled
+	cacheRecord(section, key, "ModifyRecordStatus", record)
+}
+
+// restoreRecord 启用因地址消失或线路不健康而由本程序停用的记录, 返回记录是否处于启用状态
+func restoreRecord(section *db.Section, record *dnspod.RecordInfo, remark string, domainInfo *dnspod.DomainInfo, client *dnspod.Client) bool {
+	if record.Enabled == nil || *record.Enabled != 0 || record.Id == nil {
+		return true
+	}
+	if !disabledByUs(section.DB(), *domainInfo.Domain, *record.Id) {
+		fmt.Printf("[%s] %s.%s[%s-%s] disabled manually, keeping\n", time.Now().Format("2006-01-02 15:04:05"), *record.SubDomain, *domainInfo.Domain, *record.RecordType, remark)
+		return false
+	}
+	fmt.Printf("[%s] %s.%s[%s-%s] address back, enabling\n", time.Now().Format("2006-01-02 15:04:05"), *record.SubDomain, *domainInfo.Domain, *record.RecordType, remark)
+	return enableRecord(section, *record.RecordType+"-"+remark, record, domainInfo, client)
+}
+
+// enableRecord 启用记录并更新缓存
+func enableRecord(section *db.Section, key string, record *dnspod.RecordInfo, domainInfo *dnspod.DomainInfo, client *dnspod.Client) bool {
+	if err := modifyRecordStatus(domainInfo.Domain, record, "ENABLE", client); err != nil {
+		fmt.Printf("enable failed: %s\n", err)
+		return false
+	}
+	markDisabled(section.DB(), *domainInfo.Domain, *record.Id, false)
+	var enabled uint64 = 1
+	record.Enabled = &enabled
+	cacheRecord(section, key, "ModifyRecordStatus", record)
+	return true
+}
@@ -6,4 +6,5 @@ require (
 	github.com/fsnotify/fsnotify v1.7.0
 	github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common v1.0.964
 	github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod v1.0.964
+	go.etcd.io/bbolt v1.3.7
 )
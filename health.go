@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/tls"
+	"dnspod-ddns/db"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// HealthCheck ips 名称(线路)的健康检查, 配置的检查全部通过才视为健康.
+// tcp 与 http 中的 {ip} 替换为该名称获取到的地址(优先 IPv4);
+// cmd 为本地探测命令, 退出码 0 为健康, 可通过环境变量 DDNS_REMARK/DDNS_IP 获取名称与地址
+type HealthCheck struct {
+	Tcp      string `json:"tcp"`
+	Http     string `json:"http"`
+	Cmd      string `json:"cmd"`
+	Timeout  string `json:"timeout"`
+	Insecure bool   `json:"insecure"` // http 检查不校验证书
+}
+
+// FailoverPolicy 子域名的故障切换策略. lines 为空时同时发布所有健康线路;
+// 配置 lines 时为主备模式, 只发布第一个健康的线路. 全部线路不健康时不做切换
+type FailoverPolicy struct {
+	// Action 不健康线路记录的处理: disable(默认) 或 delete
+	Action string   `json:"action"`
+	Lines  []string `json:"lines"`
+}
+
+// checkHealth 执行健康检查, 返回不健康的原因
+func checkHealth(remark string, check *HealthCheck, addrs *addresses) error {
+	timeout := 5 * time.Second
+	if check.Timeout != "" {
+		d, err := time.ParseDuration(check.Timeout)
+		if err != nil {
+			return err
+		}
+		timeout = d
+	}
+	ip := ""
+	for _, dnsType := range recordFamilies {
+		if ips := addrs.ips[dnsType]; len(ips) > 0 {
+			ip = ips[0]
+			break
+		}
+	}
+	host := ip
+	if strings.Contains(ip, ":") {
+		host = "[" + ip + "]"
+	}
+	needIp := strings.Contains(check.Tcp+check.Http, "{ip}")
+	if needIp && ip == "" {
+		return fmt.Errorf("no address")
+	}
+	if check.Tcp != "" {
+		conn, err := net.DialTimeout("tcp", strings.ReplaceAll(check.Tcp, "{ip}", host), timeout)
+		if err != nil {
+			return err
+		}
+		_ = conn.Close()
+	}
+	if check.Http != "" {
+		client := &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: check.Insecure},
+			},
+		}
+		resp, err := client.Get(strings.ReplaceAll(check.Http, "{ip}", host))
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("http status %d", resp.StatusCode)
+		}
+	}
+	if check.Cmd != "" {
+		cmd := exec.Command("sh", "-c", check.Cmd)
+		cmd.Env = append(os.Environ(), "DDNS_REMARK="+remark, "DDNS_IP="+ip)
+		done := make(chan error, 1)
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		go func() { done <- cmd.Wait() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+		case <-time.After(timeout):
+			_ = cmd.Process.Kill()
+			return fmt.Errorf("probe timeout")
+		}
+	}
+	return nil
+}
+
+// activeRemarks 按故障切换策略返回子域名本次发布的 ips 名称, 未配置策略时返回 nil
+func activeRemarks(domain, subDomain string, candidates []string, remarks map[string]*addresses) map[string]bool {
+	policy, ok := config.Failover[domain][subDomain]
+	if !ok {
+		return nil
+	}
+	isCandidate := make(map[string]bool)
+	for _, name := range candidates {
+		isCandidate[name] = true
+	}
+	healthy := func(name string) bool {
+		addrs, ok := remarks[name]
+		return ok && !addrs.unhealthy
+	}
+	active := make(map[string]bool)
+	if len(policy.Lines) > 0 {
+		first := ""
+		for _, name := range policy.Lines {
+			if !isCandidate[name] {
+				continue
+			}
+			if first == "" {
+				first = name
+			}
+			if healthy(name) {
+				active[name] = true
+				return active
+			}
+		}
+		if first != "" {
+			active[first] = true
+		}
+		return active
+	}
+	for _, name := range candidates {
+		if healthy(name) {
+			active[name] = true
+		}
+	}
+	if len(active) == 0 {
+		for _, name := range candidates {
+			active[name] = true
+		}
+	}
+	return active
+}
+
+// withdrawRemark 撤下子域名中某个 ips 名称的记录, 线路恢复后由同步重新启用或创建
+func withdrawRemark(section *db.Section, subDomain, remark string, domainInfo *dnspod.DomainInfo, client *dnspod.Client) {
+	action := config.Failover[*domainInfo.Domain][subDomain].Action
+	for _, dnsType := range append(recordFamilies, "HTTPS") {
+		key := dnsType + "-" + remark
+		if action == "delete" {
+			removeRecordSet(section, subDomain, key, domainInfo, client)
+			continue
+		}
+		set, _ := getRecordSet(section, key)
+		for _, record := range set {
+			if record.Id == nil || record.Enabled != nil && *record.Enabled == 0 {
+				continue
+			}
+			fmt.Printf("[%s] %s.%s[%s] line unhealthy, disabling %s\n", time.Now().Format("2006-01-02 15:04:05"), subDomain, *domainInfo.Domain, key, *record.Value)
+			disableRecord(section, key, record, domainInfo, client)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// importedConfig import 生成的配置, 只包含可从账号中得到的部分
+type importedConfig struct {
+	SecretId     string                 `json:"secretId"`
+	SecretKey    string                 `json:"secretKey"`
+	RemarkPrefix string                 `json:"remarkPrefix,omitempty"`
+	Domains      map[string][]string    `json:"domains"`
+	Ips          map[string]interface{} `json:"ips"`
+	// Adopt 备注缺少 remarkPrefix 的记录不导入, 只列出其子域名供确认后接管
+	Adopt map[string][]string `json:"adopt,omitempty"`
+}
+
+// importCommand import [-secretId ID -secretKey KEY] [-domain 通配符] [-remark 名称] [-value 值]:
+// 按备注归类账号中的 A/AAAA 记录, 输出配置. 凭据依次取自参数、环境变量 TENCENTCLOUD_SECRET_ID/TENCENTCLOUD_SECRET_KEY 及配置文件.
+// ips 的命令输出当前记录值, 需替换为实际获取 IP 的命令
+func importCommand(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	secretId := flags.String("secretId", envOr("TENCENTCLOUD_SECRET_ID", config.SecretId), "API 密钥 SecretId")
+	secretKey := flags.String("secretKey", envOr("TENCENTCLOUD_SECRET_KEY", config.SecretKey), "API 密钥 SecretKey")
+	domainPattern := flags.String("domain", "", "只导入匹配该通配符的域名")
+	remarkFilter := flags.String("remark", "", "只导入该备注的记录")
+	valueFilter := flags.String("value", "", "只导入该值的记录")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *secretId == "" || *secretKey == "" {
+		return fmt.Errorf("no credentials: set secretId/secretKey in the config, the flags or TENCENTCLOUD_SECRET_ID/TENCENTCLOUD_SECRET_KEY")
+	}
+	config.SecretId, config.SecretKey = *secretId, *secretKey
+	client := newClient()
+	domains, err := listDomains(DomainSelector{}, client)
+	if err != nil {
+		return err
+	}
+	sort.Strings(domains)
+	out := importedConfig{
+		SecretId:     config.SecretId,
+		SecretKey:    config.SecretKey,
+		RemarkPrefix: config.RemarkPrefix,
+		Domains:      make(map[string][]string),
+		Ips:          make(map[string]interface{}),
+		Adopt:        make(map[string][]string),
+	}
+	// 名称 -> 记录 -> 类型 -> 值
+	values := make(map[string]map[string]map[string][]string)
+	var names []string
+	skipped := 0
+	for _, domain := range domains {
+		if *domainPattern != "" {
+			if ok, err := path.Match(*domainPattern, domain); err != nil || !ok {
+				continue
+			}
+		}
+		d := domain
+		records, err := listRecords(&d, "", "", client)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if *record.Type != "A" && *record.Type != "AAAA" {
+				continue
+			}
+			if *valueFilter != "" && *record.Value != *valueFilter {
+				continue
+			}
+			if *record.Remark == "" {
+				skipped++
+				continue
+			}
+			name := *record.Remark
+			if config.RemarkPrefix != "" {
+				if !strings.HasPrefix(name, config.RemarkPrefix) {
+					// 非本程序创建的记录, 由用户决定是否接管
+					if !contains(out.Adopt[domain], *record.Name) {
+						out.Adopt[domain] = append(out.Adopt[domain], *record.Name)
+					}
+					continue
+				}
+				name = strings.TrimPrefix(name, config.RemarkPrefix)
+				if name == "" {
+					skipped++
+					continue
+				}
+			}
+			if *remarkFilter != "" && name != *remarkFilter {
+				continue
+			}
+			entry := *record.Name + "#" + name
+			if values[name] == nil {
+				values[name] = make(map[string]map[string][]string)
+				names = append(names, name)
+			}
+			if values[name][domain+"/"+entry] == nil {
+				values[name][domain+"/"+entry] = make(map[string][]string)
+				out.Domains[domain] = append(out.Domains[domain], entry)
+			}
+			values[name][domain+"/"+entry][*record.Type] = append(values[name][domain+"/"+entry][*record.Type], *record.Value)
+		}
+	}
+	// 同一名称在各子域名下须为相同的地址, 否则无法用一条 ips 配置表示
+	var conflicts []string
+	sort.Strings(names)
+	for _, name := range names {
+		ips, multiple, c := groupRemark(name, values[name])
+		conflicts = append(conflicts, c...)
+		cmd := "echo '" + strings.Join(ips, " ") + "'"
+		if multiple {
+			out.Ips[name] = map[string]interface{}{"cmd": cmd, "multiple": true}
+		} else {
+			out.Ips[name] = cmd
+		}
+	}
+	if len(conflicts) > 0 {
+		for _, c := range conflicts {
+			fmt.Fprintln(os.Stderr, c)
+		}
+		return fmt.Errorf("%d remarks have different values on different subdomains, rename them or import with -remark/-value", len(conflicts))
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "%d records without remark skipped\n", skipped)
+	}
+	if len(out.Adopt) > 0 {
+		fmt.Fprintf(os.Stderr, "records without remark prefix %s are listed in adopt, not imported\n", config.RemarkPrefix)
+	}
+	data, err := json.MarshalIndent(out, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// groupRemark 合并同一名称在各子域名下的记录值. entries 为 域名/记录 -> 类型 -> 值,
+// 返回按类型排序的地址、是否有类型含多个地址, 以及与第一条记录不同的冲突说明
+func groupRemark(name string, entries map[string]map[string][]string) ([]string, bool, []string) {
+	var ips, conflicts []string
+	multiple := false
+	var first, firstEntry string
+	var keys []string
+	for entry := range entries {
+		keys = append(keys, entry)
+	}
+	sort.Strings(keys)
+	for _, entry := range keys {
+		var set []string
+		for _, dnsType := range recordFamilies {
+			addrs := sortedCopy(entries[entry][dnsType])
+			if len(addrs) > 1 {
+				multiple = true
+			}
+			set = append(set, dnsType+":"+strings.Join(addrs, ","))
+		}
+		key := strings.Join(set, " ")
+		if firstEntry == "" {
+			first, firstEntry = key, entry
+			for _, dnsType := range recordFamilies {
+				ips = append(ips, sortedCopy(entries[entry][dnsType])...)
+			}
+			continue
+		}
+		if key != first {
+			conflicts = append(conflicts, fmt.Sprintf("%s: %s has %s, %s has %s", name, firstEntry, first, entry, key))
+		}
+	}
+	return ips, multiple, conflicts
+}
+
+// envOr 环境变量非空时返回其值, 否则返回 fallback
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupRemark(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   map[string]map[string][]string
+		ips       []string
+		multiple  bool
+		conflicts []string
+	}{
+		{
+			name: "same addresses everywhere",
+			entries: map[string]map[string][]string{
+				"example.com/www#home": {"A": {"192.0.2.1"}, "AAAA": {"2001:db8::1"}},
+				"example.net/@#home":   {"AAAA": {"2001:db8::1"}, "A": {"192.0.2.1"}},
+			},
+			ips: []string{"192.0.2.1", "2001:db8::1"},
+		},
+		{
+			name: "order of values does not matter",
+			entries: map[string]map[string][]string{
+				"example.com/www#home": {"A": {"192.0.2.2", "192.0.2.1"}},
+				"example.com/api#home": {"A": {"192.0.2.1", "192.0.2.2"}},
+			},
+			ips:      []string{"192.0.2.1", "192.0.2.2"},
+			multiple: true,
+		},
+		{
+			name: "different address",
+			entries: map[string]map[string][]string{
+				"example.com/api#home": {"A": {"192.0.2.1"}},
+				"example.com/www#home": {"A": {"192.0.2.9"}},
+			},
+			ips:       []string{"192.0.2.1"},
+			conflicts: []string{"home: example.com/api#home has A:192.0.2.1 AAAA:, example.com/www#home has A:192.0.2.9 AAAA:"},
+		},
+		{
+			name: "family missing on one subdomain",
+			entries: map[string]map[string][]string{
+				"example.com/api#home": {"A": {"192.0.2.1"}, "AAAA": {"2001:db8::1"}},
+				"example.com/www#home": {"A": {"192.0.2.1"}},
+			},
+			ips:       []string{"192.0.2.1", "2001:db8::1"},
+			conflicts: []string{"home: example.com/api#home has A:192.0.2.1 AAAA:2001:db8::1, example.com/www#home has A:192.0.2.1 AAAA:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ips, multiple, conflicts := groupRemark("home", tt.entries)
+			if !reflect.DeepEqual(ips, tt.ips) || multiple != tt.multiple {
+				t.Errorf("groupRemark() = %v, %v, want %v, %v", ips, multiple, tt.ips, tt.multiple)
+			}
+			if !reflect.DeepEqual(conflicts, tt.conflicts) {
+				t.Errorf("conflicts = %q, want %q", conflicts, tt.conflicts)
+			}
+		})
+	}
+}
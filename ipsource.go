@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IpSource 获取 IP 的命令. 配置为字符串时即 Cmd, 输出中的 IPv4 与 IPv6 地址都会发布;
+// 也可分别配置 ipv4/ipv6 命令. multiple 为 true 时输出中同类型的所有地址作为记录集合发布, 否则只取第一个.
+// 配置 prefix(输出前缀的命令) 或 prefixInterface(取该接口的全局 IPv6 地址) 时, IPv6 地址由
+// 当前前缀与 suffixes 中各子域名的接口标识组合而成, suffixes 的键为 "子域名" 或 "子域名.域名"
+type IpSource struct {
+	Cmd             string            `json:"cmd"`
+	IPv4            string            `json:"ipv4"`
+	IPv6            string            `json:"ipv6"`
+	Multiple        bool              `json:"multiple"`
+	Prefix          string            `json:"prefix"`
+	PrefixInterface string            `json:"prefixInterface"`
+	PrefixLength    int               `json:"prefixLength"`
+	Suffixes        map[string]string `json:"suffixes"`
+	Health          *HealthCheck      `json:"health"`
+}
+
+func (s *IpSource) UnmarshalJSON(data []byte) error {
+	var cmd string
+	if err := json.Unmarshal(data, &cmd); err == nil {
+		*s = IpSource{Cmd: cmd}
+		return nil
+	}
+	type plain IpSource
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// addresses 某个 ips 名称本次获取到的地址, 按记录类型(A/AAAA)区分
+type addresses struct {
+	ips    map[string][]string
+	failed map[string]bool // 命令执行失败, 无法判断该类型地址是否存在
+	// unhealthy 健康检查未通过
+	unhealthy bool
+
+	delegated bool       // IPv6 地址按子域名由前缀生成
+	prefix    *net.IPNet // 获取失败时为 nil
+	suffixes  map[string]string
+}
+
+// forSubdomain 返回子域名实际使用的地址. 前缀委派时未配置接口标识的子域名不管理 AAAA 记录
+func (a *addresses) forSubdomain(domain, subDomain string) *addresses {
+	if !a.delegated {
+		return a
+	}
+	r := &addresses{ips: make(map[string][]string), failed: make(map[string]bool), unhealthy: a.unhealthy}
+	for dnsType, ip := range a.ips {
+		r.ips[dnsType] = ip
+	}
+	for dnsType, failed := range a.failed {
+		r.failed[dnsType] = failed
+	}
+	suffix, ok := a.suffixes[subDomain+"."+domain]
+	if !ok {
+		suffix, ok = a.suffixes[subDomain]
+	}
+	if !ok || a.prefix == nil {
+		r.failed["AAAA"] = true
+		return r
+	}
+	ip, err := combinePrefix(a.prefix, suffix)
+	if err != nil {
+		fmt.Printf("[%s] %s.%s: %s\n", time.Now().Format("2006-01-02 15:04:05"), subDomain, domain, err)
+		r.failed["AAAA"] = true
+		return r
+	}
+	r.ips["AAAA"] = []string{ip}
+	return r
+}
+
+// combinePrefix 前缀部分取自 prefix, 其余位取自 suffix
+func combinePrefix(prefix *net.IPNet, suffix string) (string, error) {
+	id := net.ParseIP(suffix)
+	if id == nil || id.To4() != nil {
+		return "", fmt.Errorf("invalid interface id %s", suffix)
+	}
+	ip := make(net.IP, net.IPv6len)
+	base := prefix.IP.To16()
+	for i := range ip {
+		ip[i] = base[i]&prefix.Mask[i] | id[i]&^prefix.Mask[i]
+	}
+	return ip.String(), nil
+}
+
+// detectPrefix 获取当前委派的 IPv6 前缀
+func detectPrefix(src IpSource) (*net.IPNet, error) {
+	var ip net.IP
+	var mask net.IPMask
+	if src.PrefixInterface != "" {
+		iface, err := net.InterfaceByName(src.PrefixInterface)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			// 跳过 IPv4、链路本地及 ULA(fc00::/7) 地址
+			if !ok || ipNet.IP.To4() != nil || !ipNet.IP.IsGlobalUnicast() || ipNet.IP[0]&0xfe == 0xfc {
+				continue
+			}
+			ip, mask = ipNet.IP, ipNet.Mask
+			break
+		}
+		if ip == nil {
+			return nil, fmt.Errorf("no global IPv6 address on %s", src.PrefixInterface)
+		}
+	} else {
+		out, err := runIpCommand(src.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range strings.Fields(out) {
+			if cidrIp, ipNet, err := net.ParseCIDR(field); err == nil && cidrIp.To4() == nil {
+				ip, mask = cidrIp, ipNet.Mask
+				break
+			}
+			if getDNSType(field) == "AAAA" {
+				ip = net.ParseIP(field)
+				break
+			}
+		}
+		if ip == nil {
+			return nil, fmt.Errorf("no IPv6 prefix in output of %s", src.Prefix)
+		}
+	}
+	if src.PrefixLength > 0 || mask == nil {
+		length := src.PrefixLength
+		if length <= 0 {
+			length = 64
+		}
+		mask = net.CIDRMask(length, 128)
+	}
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}, nil
+}
+
+var recordFamilies = []string{"A", "AAAA"}
+
+// familyAddresses 从命令输出中取出对应记录类型的地址, multiple 为 false 时只取第一个.
+// 兼容 ip addr 的输出: 192.0.2.1/24 取主机地址, brd 后的广播地址忽略
+func familyAddresses(out, dnsType string, multiple bool) []string {
+	var ips []string
+	seen := make(map[string]bool)
+	fields := strings.Fields(out)
+	for i, field := range fields {
+		if i > 0 && fields[i-1] == "brd" {
+			continue
+		}
+		if ip, _, err := net.ParseCIDR(field); err == nil {
+			field = ip.String()
+		}
+		if getDNSType(field) != dnsType || seen[field] {
+			continue
+		}
+		ips = append(ips, field)
+		seen[field] = true
+		if !multiple {
+			break
+		}
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+func runIpCommand(cmd string) (string, error) {
+	out, err := exec.Command("sh", "-c", cmd).Output()
+	return string(out), err
+}
+
+func detectAddresses(src IpSource) *addresses {
+	addrs := &addresses{ips: make(map[string][]string), failed: make(map[string]bool)}
+	cmds := map[string]string{"A": src.IPv4, "AAAA": src.IPv6}
+	for _, dnsType := range recordFamilies {
+		if cmds[dnsType] == "" {
+			cmds[dnsType] = src.Cmd
+		}
+	}
+	if src.Prefix != "" || src.PrefixInterface != "" {
+		addrs.delegated = true
+		addrs.suffixes = src.Suffixes
+		prefix, err := detectPrefix(src)
+		if err != nil {
+			fmt.Printf("%s\n", err)
+		}
+		addrs.prefix = prefix
+		// IPv6 地址由前缀生成, 不执行命令
+		cmds["AAAA"] = ""
+	}
+	outputs := make(map[string]string)
+	failures := make(map[string]bool)
+	for _, dnsType := range recordFamilies {
+		cmd := cmds[dnsType]
+		if cmd == "" {
+			continue
+		}
+		out, ok := outputs[cmd]
+		if !ok && !failures[cmd] {
+			var err error
+			out, err = runIpCommand(cmd)
+			if err != nil {
+				fmt.Printf("%s\n", err)
+				failures[cmd] = true
+			} else {
+				outputs[cmd] = out
+			}
+		}
+		if failures[cmd] {
+			addrs.failed[dnsType] = true
+			continue
+		}
+		if ips := familyAddresses(out, dnsType, src.Multiple); len(ips) > 0 {
+			addrs.ips[dnsType] = ips
+		}
+	}
+	return addrs
+}
+
+// detectRemarks 获取所有 ips 名称当前的地址
+func detectRemarks() map[string]*addresses {
+	remarks := make(map[string]*addresses)
+	for remark, src := range config.Ips {
+		addrs := detectAddresses(src)
+		remarks[remark] = addrs
+		var found []string
+		for _, dnsType := range recordFamilies {
+			found = append(found, addrs.ips[dnsType]...)
+		}
+		sort.Strings(found)
+		if addrs.prefix != nil {
+			found = append(found, "prefix "+addrs.prefix.String())
+		}
+		fmt.Printf("[%s] got remark: %s, IP: %s\n", time.Now().Format("2006-01-02 15:04:05"), remark, strings.Join(found, " "))
+		if src.Health != nil {
+			if err := checkHealth(remark, src.Health, addrs); err != nil {
+				addrs.unhealthy = true
+				fmt.Printf("[%s] remark %s unhealthy: %s\n", time.Now().Format("2006-01-02 15:04:05"), remark, err)
+			}
+		}
+		auditDetection(remark, remarkSummary(addrs))
+	}
+	return remarks
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestCombinePrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		suffix  string
+		want    string
+		wantErr bool
+	}{
+		{"/64 prefix", "2001:db8:1:2::/64", "::1", "2001:db8:1:2::1", false},
+		{"interface id", "2001:db8:1:2::/64", "::211:22ff:fe33:4455", "2001:db8:1:2:211:22ff:fe33:4455", false},
+		{"prefix bits in suffix ignored", "2001:db8:1:2::/64", "fe80::1", "2001:db8:1:2::1", false},
+		{"host bits in prefix ignored", "2001:db8:1:2:ffff::1/64", "::2", "2001:db8:1:2::2", false},
+		{"/56 prefix", "2001:db8:1:200::/56", "0:0:0:34::1", "2001:db8:1:234::1", false},
+		{"/60 prefix", "2001:db8:1:20::/60", "::5:0:0:0:1", "2001:db8:1:25::1", false},
+		{"ipv4 suffix", "2001:db8:1:2::/64", "192.0.2.1", "", true},
+		{"invalid suffix", "2001:db8:1:2::/64", "not-an-ip", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, ipNet, err := net.ParseCIDR(tt.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 保留主机位, 与接口上读取到的地址一致
+			prefix := &net.IPNet{IP: ip, Mask: ipNet.Mask}
+			got, err := combinePrefix(prefix, tt.suffix)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("combinePrefix(%s, %s) error = %v, wantErr %v", tt.prefix, tt.suffix, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("combinePrefix(%s, %s) = %s, want %s", tt.prefix, tt.suffix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFamilyAddresses(t *testing.T) {
+	tests := []struct {
+		name     string
+		out      string
+		dnsType  string
+		multiple bool
+		want     []string
+	}{
+		{"single ipv4", "192.0.2.1\n", "A", false, []string{"192.0.2.1"}},
+		{"first of several", "192.0.2.9 192.0.2.1", "A", false, []string{"192.0.2.9"}},
+		{"multiple sorted", "192.0.2.9\n192.0.2.1\n", "A", true, []string{"192.0.2.1", "192.0.2.9"}},
+		{"duplicates removed", "192.0.2.1 192.0.2.1", "A", true, []string{"192.0.2.1"}},
+		{"mixed families ipv4", "2001:db8::1 192.0.2.1", "A", true, []string{"192.0.2.1"}},
+		{"mixed families ipv6", "2001:db8::1 192.0.2.1 2001:db8::2", "AAAA", true, []string{"2001:db8::1", "2001:db8::2"}},
+		{"ip addr output", "inet 192.0.2.1/24 brd 192.0.2.255 scope global eth0", "A", true, []string{"192.0.2.1"}},
+		{"ip addr ipv6 output", "inet6 2001:db8::1/64 scope global", "AAAA", false, []string{"2001:db8::1"}},
+		{"words ignored", "address: 192.0.2.1 (cached)", "A", true, []string{"192.0.2.1"}},
+		{"no address", "error: timeout", "A", false, nil},
+		{"empty", "", "AAAA", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := familyAddresses(tt.out, tt.dnsType, tt.multiple)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("familyAddresses(%q, %s, %v) = %v, want %v", tt.out, tt.dnsType, tt.multiple, got, tt.want)
+			}
+		})
+	}
+}
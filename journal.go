@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bufio"
+	"dnspod-ddns/db"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// journalKeep 保留的运行日志数量
+const journalKeep = 100
+
+// runId 本次运行的标识, 即日志文件名
+var runId = time.Now().Format("20060102-150405") + "-" + strconv.Itoa(os.Getpid())
+
+// journalEntry 一次修改 DNSPod 记录的调用, Old 为修改前的记录(创建时为空)
+type journalEntry struct {
+	Time      int64              `json:"time"`
+	Run       string             `json:"run"`
+	Action    string             `json:"action"`
+	Domain    string             `json:"domain"`
+	RecordId  uint64             `json:"recordId"`
+	Old       *dnspod.RecordInfo `json:"old,omitempty"`
+	Request   json.RawMessage    `json:"request"`
+	RequestId string             `json:"requestId"`
+	// Rollback 撤销的运行, 非空表示本条为 rollback 产生的修改
+	Rollback string `json:"rollback,omitempty"`
+}
+
+var (
+	journalGuard   sync.Mutex
+	journalStarted bool
+	// rollingBack rollback 命令正在撤销的运行
+	rollingBack string
+)
+
+// journalDir 运行日志目录, 与缓存同级
+func journalDir() string {
+	return *cachePath + ".journal"
+}
+
+// writeJournal 记录修改调用, 写入失败只打印不影响同步
+func writeJournal(action string, domain *string, recordId *uint64, old *dnspod.RecordInfo, request interface{}, requestId *string) {
+	journalGuard.Lock()
+	defer journalGuard.Unlock()
+	if !journalStarted {
+		journalStarted = true
+		if err := os.MkdirAll(journalDir(), 0755); err != nil {
+			fmt.Printf("journal: %s\n", err)
+		}
+		trimJournal()
+	}
+	entry := journalEntry{Time: time.Now().Unix(), Run: runId, Action: action, Old: old, Rollback: rollingBack}
+	if domain != nil {
+		entry.Domain = *domain
+	}
+	if recordId != nil {
+		entry.RecordId = *recordId
+	}
+	if requestId != nil {
+		entry.RequestId = *requestId
+	}
+	entry.Request, _ = json.Marshal(request)
+	line, _ := json.Marshal(entry)
+	f, err := os.OpenFile(filepath.Join(journalDir(), runId+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Printf("journal: %s\n", err)
+		return
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		fmt.Printf("journal: %s\n", err)
+	}
+}
+
+// journalRuns 已记录的运行, 按时间排序
+func journalRuns() []string {
+	files, _ := ioutil.ReadDir(journalDir())
+	var runs []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".jsonl") {
+			runs = append(runs, strings.TrimSuffix(f.Name(), ".jsonl"))
+		}
+	}
+	sort.Strings(runs)
+	return runs
+}
+
+// trimJournal 只保留最近 journalKeep 次运行
+func trimJournal() {
+	runs := journalRuns()
+	for len(runs) > journalKeep {
+		_ = os.Remove(filepath.Join(journalDir(), runs[0]+".jsonl"))
+		runs = runs[1:]
+	}
+}
+
+func readJournal(run string) ([]journalEntry, error) {
+	f, err := os.Open(filepath.Join(journalDir(), run+".jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	var entries []journalEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// 写入中断的行
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// runsCommand history: 列出已记录的运行及其修改次数
+func runsCommand() error {
+	runs := journalRuns()
+	if len(runs) == 0 {
+		fmt.Println("no journal")
+		return nil
+	}
+	for _, run := range runs {
+		entries, err := readJournal(run)
+		if err != nil || len(entries) == 0 {
+			continue
+		}
+		counts := make(map[string]int)
+		domains := make(map[string]bool)
+		for _, entry := range entries {
+			counts[entry.Action]++
+			domains[entry.Domain] = true
+		}
+		var parts []string
+		for action, n := range counts {
+			parts = append(parts, fmt.Sprintf("%s=%d", action, n))
+		}
+		sort.Strings(parts)
+		var names []string
+		for domain := range domains {
+			names = append(names, domain)
+		}
+		sort.Strings(names)
+		if entries[0].Rollback != "" {
+			parts = append(parts, "rollback-of="+entries[0].Rollback)
+		}
+		fmt.Printf("%s  %s  %s  %s\n", run, time.Unix(entries[0].Time, 0).Format("2006-01-02 15:04:05"), strings.Join(parts, " "), strings.Join(names, ","))
+	}
+	return nil
+}
+
+// rollbackTarget 默认撤销的运行: 最近一次既不是 rollback、也未被撤销过的运行
+func rollbackTarget() string {
+	runs := journalRuns()
+	undone := make(map[string]bool)
+	rollbacks := make(map[string]bool)
+	for _, run := range runs {
+		entries, err := readJournal(run)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.Rollback != "" {
+				rollbacks[run] = true
+				undone[entry.Rollback] = true
+			}
+		}
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if !rollbacks[runs[i]] && !undone[runs[i]] {
+			return runs[i]
+		}
+	}
+	return ""
+}
+
+// rollbackCommand rollback [run-id]: 按相反顺序撤销一次运行中的修改, 默认为最近一次未撤销的运行.
+// 指定 rollback 产生的运行时撤销该次 rollback
+func rollbackCommand(dbh *db.DB, client *dnspod.Client, args []string) error {
+	run := ""
+	if len(args) > 0 {
+		run = args[0]
+	} else {
+		run = rollbackTarget()
+	}
+	if run == "" {
+		return fmt.Errorf("no journal to roll back")
+	}
+	entries, err := readJournal(run)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[%s] rolling back run %s (%d changes)\n", time.Now().Format("2006-01-02 15:04:05"), run, len(entries))
+	rollingBack = run
+	defer func() { rollingBack = "" }()
+	// 重新创建的记录 Id 会变化, 较早的修改须作用于新记录
+	ids := make(map[uint64]uint64)
+	failed := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := undoEntry(entries[i], ids, client); err != nil {
+			fmt.Printf("[%s] undo %s %s record %d failed: %s\n", time.Now().Format("2006-01-02 15:04:05"), entries[i].Action, entries[i].Domain, entries[i].RecordId, err)
+			failed++
+		}
+	}
+	// 缓存已与 DNSPod 不一致, 下次运行时刷新
+	_ = dbh.Put(0, "cacheTime")
+	if failed > 0 {
+		return fmt.Errorf("%d changes not rolled back", failed)
+	}
+	return nil
+}
+
+// remapEntry 修改针对的记录 Id 及修改前的记录, 记录在撤销中被重新创建时换为新 Id
+func remapEntry(entry journalEntry, ids map[uint64]uint64) (uint64, *dnspod.RecordInfo) {
+	recordId := entry.RecordId
+	if id, ok := ids[recordId]; ok {
+		recordId = id
+	}
+	old := entry.Old
+	if old != nil {
+		o := *old
+		o.Id = &recordId
+		old = &o
+	}
+	return recordId, old
+}
+
+// undoEntry 撤销一次修改, 撤销本身也记入本次运行的日志. ids 为已重新创建记录的原 Id 到新 Id
+func undoEntry(entry journalEntry, ids map[uint64]uint64, client *dnspod.Client) error {
+	domain := entry.Domain
+	recordId, old := remapEntry(entry, ids)
+	switch entry.Action {
+	case "CreateRecord":
+		record := &dnspod.RecordInfo{Id: &recordId}
+		var request dnspod.CreateRecordRequest
+		if json.Unmarshal(entry.Request, &request) == nil {
+			// 保留创建时的内容, 以便再次撤销
+			record.SubDomain, record.RecordType, record.Value = request.SubDomain, request.RecordType, request.Value
+			record.RecordLine, record.MX, record.TTL, record.Remark = request.RecordLine, request.MX, request.TTL, request.Remark
+		}
+		if recordId == 0 {
+			// 批量创建时任务未返回记录 Id, 按内容查找
+			id, err := findCreated(&domain, &request, client)
+			if err != nil {
+				return err
+			}
+			record.Id = &id
+		}
+		return deleteRecord(&domain, record, client)
+	case "DeleteRecord":
+		if old == nil {
+			return fmt.Errorf("no previous record")
+		}
+		request := dnspod.NewCreateRecordRequest()
+		request.Domain = &domain
+		request.SubDomain = old.SubDomain
+		request.RecordType = old.RecordType
+		request.RecordLine = old.RecordLine
+		request.RecordLineId = old.RecordLineId
+		request.Value = old.Value
+		request.MX = old.MX
+		request.TTL = old.TTL
+		request.Weight = old.Weight
+		request.Remark = old.Remark
+		if old.Enabled != nil && *old.Enabled == 0 {
+			status := "DISABLE"
+			request.Status = &status
+		}
+		response, err := addRecord(request, client)
+		if err != nil {
+			return err
+		}
+		if response != nil && response.Response != nil && response.Response.RecordId != nil {
+			ids[entry.RecordId] = *response.Response.RecordId
+		}
+		return nil
+	case "ModifyRecord":
+		if old == nil {
+			return fmt.Errorf("no previous record")
+		}
+		request := dnspod.NewModifyRecordRequest()
+		request.Domain = &domain
+		request.RecordId = &recordId
+		request.SubDomain = old.SubDomain
+		request.RecordType = old.RecordType
+		request.RecordLine = old.RecordLine
+		request.RecordLineId = old.RecordLineId
+		request.Value = old.Value
+		request.MX = old.MX
+		request.TTL = old.TTL
+		request.Weight = old.Weight
+		request.Remark = old.Remark
+		// 当前记录为原请求修改后的内容
+		current := *old
+		var applied dnspod.ModifyRecordRequest
+		if json.Unmarshal(entry.Request, &applied) == nil {
+			current.SubDomain, current.RecordType, current.Value = applied.SubDomain, applied.RecordType, applied.Value
+			current.RecordLine, current.MX, current.TTL, current.Remark = applied.RecordLine, applied.MX, applied.TTL, applied.Remark
+		}
+		_, err := modifyRecord(request, &current, client)
+		return err
+	case "ModifyRecordStatus":
+		if old == nil {
+			return fmt.Errorf("no previous record")
+		}
+		status := "ENABLE"
+		var enabled uint64 = 0
+		if old.Enabled != nil && *old.Enabled == 0 {
+			status = "DISABLE"
+			enabled = 1
+		}
+		current := *old
+		current.Enabled = &enabled
+		return modifyRecordStatus(&domain, &current, status, client)
+	case "ModifyRecordRemark":
+		if old == nil {
+			return fmt.Errorf("no previous record")
+		}
+		remark := ""
+		if old.Remark != nil {
+			remark = *old.Remark
+		}
+		current := *old
+		var applied dnspod.ModifyRecordRemarkRequest
+		if json.Unmarshal(entry.Request, &applied) == nil {
+			current.Remark = applied.Remark
+		}
+		return modifyRemark(&domain, &current, remark, client)
+	}
+	return fmt.Errorf("unknown action %s", entry.Action)
+}
+
+// findCreated 按子域名、类型、值和备注查找创建的记录
+func findCreated(domain *string, request *dnspod.CreateRecordRequest, client *dnspod.Client) (uint64, error) {
+	if request.SubDomain == nil || request.RecordType == nil {
+		return 0, fmt.Errorf("no record id")
+	}
+	list, err := listRecords(domain, *request.SubDomain, *request.RecordType, client)
+	if err != nil {
+		return 0, err
+	}
+	for _, item := range list {
+		if item.RecordId != nil && stringValue(item.Value) == stringValue(request.Value) && stringValue(item.Remark) == stringValue(request.Remark) {
+			return *item.RecordId, nil
+		}
+	}
+	return 0, fmt.Errorf("created record %s %s not found", *request.SubDomain, stringValue(request.Value))
+}
+
+// listItemInfo 将 DescribeRecordList 返回的记录转换为 RecordInfo
+func listItemInfo(item *dnspod.RecordListItem, domainId *uint64) *dnspod.RecordInfo {
+	record := &dnspod.RecordInfo{
+		Id:            item.RecordId,
+		SubDomain:     item.Name,
+		RecordType:    item.Type,
+		RecordLine:    item.Line,
+		RecordLineId:  item.LineId,
+		Value:         item.Value,
+		Weight:        item.Weight,
+		MX:            item.MX,
+		TTL:           item.TTL,
+		MonitorStatus: item.MonitorStatus,
+		Remark:        item.Remark,
+		UpdatedOn:     item.UpdatedOn,
+		DomainId:      domainId,
+	}
+	if item.Status != nil {
+		var enabled uint64 = 1
+		if *item.Status != "ENABLE" {
+			enabled = 0
+		}
+		record.Enabled = &enabled
+	}
+	return record
+}
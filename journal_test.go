@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// writeRuns 在临时日志目录中写入运行, 每次运行一条记录, rollback 非空表示该运行撤销了另一运行
+func writeRuns(t *testing.T, runs [][2]string) {
+	t.Helper()
+	saved := *cachePath
+	*cachePath = filepath.Join(t.TempDir(), "dns.Cache")
+	t.Cleanup(func() { *cachePath = saved })
+	if err := os.MkdirAll(journalDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, run := range runs {
+		line, _ := json.Marshal(journalEntry{Run: run[0], Action: "ModifyRecord", Domain: "example.com", Rollback: run[1]})
+		if err := ioutil.WriteFile(filepath.Join(journalDir(), run[0]+".jsonl"), append(line, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRollbackTarget(t *testing.T) {
+	tests := []struct {
+		name string
+		runs [][2]string
+		want string
+	}{
+		{"no journal", nil, ""},
+		{"latest run", [][2]string{{"20240101-000000-1", ""}, {"20240102-000000-1", ""}}, "20240102-000000-1"},
+		{"skip rolled back run and the rollback", [][2]string{
+			{"20240101-000000-1", ""},
+			{"20240102-000000-1", ""},
+			{"20240103-000000-1", "20240102-000000-1"},
+		}, "20240101-000000-1"},
+		{"everything undone", [][2]string{
+			{"20240101-000000-1", ""},
+			{"20240102-000000-1", "20240101-000000-1"},
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeRuns(t, tt.runs)
+			if got := rollbackTarget(); got != tt.want {
+				t.Errorf("rollbackTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollbackTargetIgnoresOtherFiles(t *testing.T) {
+	writeRuns(t, [][2]string{{"20240101-000000-1", ""}})
+	_ = ioutil.WriteFile(filepath.Join(journalDir(), "notes.txt"), []byte("x"), 0644)
+	_ = os.Mkdir(filepath.Join(journalDir(), "20250101-000000-1.jsonl"), 0755)
+	if got := rollbackTarget(); got != "20240101-000000-1" {
+		t.Errorf("rollbackTarget() = %q", got)
+	}
+}
+
+func TestRemapEntry(t *testing.T) {
+	value := "192.0.2.1"
+	var original uint64 = 100
+	entry := journalEntry{Action: "ModifyRecord", RecordId: 100, Old: &dnspod.RecordInfo{Id: &original, Value: &value}}
+
+	// 记录未被重新创建时保持原 Id
+	recordId, old := remapEntry(entry, map[uint64]uint64{})
+	if recordId != 100 || *old.Id != 100 || *old.Value != value {
+		t.Errorf("remapEntry() = %d, %+v", recordId, old)
+	}
+
+	// 撤销删除后记录以新 Id 重新创建, 更早的修改作用于新记录, 日志中的原记录不变
+	recordId, old = remapEntry(entry, map[uint64]uint64{100: 200})
+	if recordId != 200 || *old.Id != 200 || *old.Value != value {
+		t.Errorf("remapEntry() remapped = %d, %+v", recordId, old)
+	}
+	if *entry.Old.Id != 100 {
+		t.Errorf("journal entry changed to Id %d", *entry.Old.Id)
+	}
+
+	recordId, old = remapEntry(journalEntry{Action: "CreateRecord", RecordId: 300}, map[uint64]uint64{100: 200})
+	if recordId != 300 || old != nil {
+		t.Errorf("remapEntry() create = %d, %+v", recordId, old)
+	}
+}
+
+func TestReadJournalSkipsTornLines(t *testing.T) {
+	writeRuns(t, [][2]string{{"20240101-000000-1", ""}})
+	path := filepath.Join(journalDir(), "20240101-000000-1.jsonl")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"action":"Delete`)
+	_ = f.Close()
+	entries, err := readJournal("20240101-000000-1")
+	if err != nil || len(entries) != 1 || entries[0].Action != "ModifyRecord" {
+		t.Errorf("readJournal() = %+v, %v", entries, err)
+	}
+}
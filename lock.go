@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exitLocked 另一实例正在运行且等待超时时的退出码
+const exitLocked = 3
+
+var errLocked = errors.New("another instance is running")
+
+// instanceLock 缓存目录旁的锁文件, 防止 cron 重叠运行时并发修改同一批记录.
+// 锁由操作系统的文件锁持有, 进程退出(包括崩溃/被杀)时自动释放, 文件中的 PID 仅用于提示
+type instanceLock struct {
+	path string
+	file *os.File
+}
+
+func lockPath(cacheRoot string) string {
+	return strings.TrimSuffix(cacheRoot, string(os.PathSeparator)) + ".lock"
+}
+
+// acquireLock 获取锁. 锁被其他进程持有时最多等待 wait
+func acquireLock(cacheRoot string, wait time.Duration) (*instanceLock, error) {
+	l := &instanceLock{path: lockPath(cacheRoot)}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		err := l.tryLock()
+		if err == nil {
+			return l, nil
+		}
+		if !errors.Is(err, errLocked) {
+			return nil, err
+		}
+		if !time.Now().Before(deadline) {
+			return nil, err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (l *instanceLock) tryLock() error {
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err := lockFile(f); err != nil {
+		_ = f.Close()
+		if errors.Is(err, errLocked) {
+			if pid, err := l.owner(); err == nil {
+				return fmt.Errorf("%w (pid %d, lock %s)", errLocked, pid, l.path)
+			}
+			return fmt.Errorf("%w (lock %s)", errLocked, l.path)
+		}
+		return err
+	}
+	// 持有锁后再写入 PID, 其他进程只读取不据此判断
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+	l.file = f
+	return nil
+}
+
+func (l *instanceLock) owner() (int, error) {
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// Release 释放锁. 锁文件保留, 删除会让等待中的进程锁住已脱离路径的文件
+func (l *instanceLock) Release() {
+	if l.file == nil {
+		return
+	}
+	_ = unlockFile(l.file)
+	_ = l.file.Close()
+	l.file = nil
+}
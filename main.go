@@ -7,11 +7,9 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"strings"
 	"sync"
 	"time"
@@ -30,7 +28,61 @@ type Config struct {
 	HttpRecord bool                `json:"httpRecord"`
 	H3Port     json.Number         `json:"h3Port"`
 	Domains    map[string][]string `json:"domains"`
-	Ips        map[string]string   `json:"ips"`
+	Ips        map[string]IpSource `json:"ips"`
+	Prune      PruneConfig         `json:"prune"`
+	// LostFamily 某个 ips 名称不再有 IPv4/IPv6 地址时对应记录的处理: disable, delete, 默认保留并打印
+	LostFamily string `json:"lostFamily"`
+	// RemarkOrder 接管无备注记录时 ips 名称的分配顺序
+	RemarkOrder []string `json:"remarkOrder"`
+	// RemarkPrefix 托管记录的备注前缀, 用于区分手工维护的记录
+	RemarkPrefix string `json:"remarkPrefix"`
+	// Adopt 允许接管(写入备注)的无归属记录, 域名 -> 子域名
+	Adopt map[string][]string `json:"adopt"`
+	// Records 模板记录(TXT/CNAME/SRV 等), 域名 -> 记录, 域名须同时出现在 domains 中
+	Records map[string][]TemplateRecord `json:"records"`
+	// Https HTTPS 记录参数, 域名 -> 子域名(或 "*") -> 参数
+	Https map[string]map[string]SvcbParams `json:"https"`
+	// Failover 故障切换策略, 域名 -> 子域名 -> 策略, 线路健康检查在 ips 中配置
+	Failover map[string]map[string]FailoverPolicy `json:"failover"`
+	// RollLimit 遇到 LimitExceeded.SubdomainRollLimit 时重复记录的处理策略
+	RollLimit RollLimitConfig `json:"rollLimit"`
+	// History 变更历史的保留限制
+	History HistoryConfig `json:"history"`
+	// Unchanged 地址未变化时跳过运行
+	Unchanged UnchangedConfig `json:"unchanged"`
+	// NoBatch 不使用 ModifyRecordBatch/CreateRecordBatch, 逐条修改
+	NoBatch bool `json:"noBatch"`
+	// CreateDomains 账号中不存在的域名自动创建
+	CreateDomains bool `json:"createDomains"`
+	// DomainSelect 从账号中按规则选择的域名, 与 domains 合并
+	DomainSelect []DomainSelector `json:"domainSelect"`
+}
+
+func newClient() *dnspod.Client {
+	credential := common.NewCredential(
+		config.SecretId,
+		config.SecretKey,
+	)
+	client, _ := dnspod.NewClient(credential, regions.Guangzhou, profile.NewClientProfile())
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	client.WithHttpTransport(tr)
+	return client
+}
+
+// readConfig 读取配置文件到 config, 返回其修改时间
+func readConfig(path string) (int64, error) {
+	byteValue, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	file, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	_ = json.Unmarshal(byteValue, &config)
+	return file.ModTime().Unix(), nil
 }
 
 func contains(sa []string, i string) bool {
@@ -45,6 +97,8 @@ func contains(sa []string, i string) bool {
 
 var confFilePath = flag.String("c", "dns.json", "配置文件路径")
 var cachePath = flag.String("d", "/tmp/dns.Cache", "缓存文件路径")
+var storage = flag.String("s", "file", "缓存存储: file(目录) 或 bolt(单文件 <缓存文件路径>.db)")
+var lockWait = flag.Duration("w", 0, "已有实例运行时的最长等待时间, 超时以退出码 3 退出")
 var config Config
 var rateLimiter = make(chan struct{}, 80)
 
@@ -66,120 +120,197 @@ func initRateLimiter() {
 func main() {
 	initRateLimiter()
 	flag.Parse()
-	fmt.Printf("[%s] starting ...\n", time.Now().Format("2006-01-02 15:04:05"))
-	configFile, err := os.Open(*confFilePath)
+	if flag.Arg(0) != "import" {
+		// import 的标准输出只有生成的配置
+		fmt.Printf("[%s] starting ...\n", time.Now().Format("2006-01-02 15:04:05"))
+	}
+	lock, err := acquireLock(*cachePath, *lockWait)
 	if err != nil {
 		fmt.Println(err)
+		if errors.Is(err, errLocked) {
+			os.Exit(exitLocked)
+		}
+		return
+	}
+	defer lock.Release()
+	switch flag.Arg(0) {
+	case "", "disable", "enable", "rollback", "import":
+	case "history":
+		// 无参数时列出运行日志, 否则打印子域名的变更历史或 ips 名称的地址历史
+		if len(flag.Args()) > 1 {
+			err = auditCommand(flag.Args()[1:])
+		} else {
+			err = runsCommand()
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+		return
+	case "migrate":
+		// 将目录结构的缓存迁移到单文件存储
+		if err := migrateCache(); err != nil {
+			fmt.Println(err)
+		}
+		return
+	default:
+		fmt.Printf("unknown command %s\n", flag.Arg(0))
+		return
+	}
+	modTime, err := readConfig(*confFilePath)
+	if flag.Arg(0) == "import" {
+		// 由账号中的记录生成配置, 输出到标准输出. 凭据可由参数或环境变量提供, 此时无需配置文件
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintln(os.Stderr, err)
+			lock.Release()
+			os.Exit(1)
+		}
+		if err := importCommand(flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			lock.Release()
+			os.Exit(1)
+		}
 		return
 	}
-	defer func() { _ = configFile.Close() }()
-	byteValue, _ := io.ReadAll(configFile)
-
-	file, err := os.Stat(*confFilePath)
 	if err != nil {
 		fmt.Println(err)
+		return
 	}
-	modTime := file.ModTime().Unix()
-
-	_ = json.Unmarshal(byteValue, &config)
 
-	dbh := db.DB{Root: *cachePath}
-
-	credential := common.NewCredential(
-		config.SecretId,
-		config.SecretKey,
-	)
-	client, _ := dnspod.NewClient(credential, regions.Guangzhou, profile.NewClientProfile())
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	dbh, err := openCache()
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
-	client.WithHttpTransport(tr)
-	remarks := make(map[string]string)
-	remarkNames := make([]string, len(remarks))
-	recordCounter := make(map[string]uint)
-	// 获取本地IP
-	for remark, cmd := range config.Ips {
-		out, err := exec.Command("sh", "-c", cmd).Output()
-		if err != nil {
-			fmt.Printf("%s", err)
+	defer func() { _ = dbh.Close() }()
+	if err := checkCacheSchema(dbh); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	switch cmd := flag.Arg(0); cmd {
+	case "disable", "enable":
+		if err := pauseCommand(dbh, newClient(), cmd == "disable", flag.Args()[1:]); err != nil {
+			fmt.Println(err)
 		}
-		remarks[remark] = strings.TrimSuffix(string(out), "\n")
-		remarkNames = append(remarkNames, remark)
-		fmt.Printf("[%s] got remark: %s, IP: %s", time.Now().Format("2006-01-02 15:04:05"), remark, out)
+		return
+	case "rollback":
+		if err := rollbackCommand(dbh, newClient(), flag.Args()[1:]); err != nil {
+			fmt.Println(err)
+		}
+		return
 	}
+	// 获取本地IP
+	remarks := detectRemarks()
 	var cacheTime int64
 	_ = dbh.Get(&cacheTime, "cacheTime")
+	if canSkipRun(dbh, remarks, cacheTime > 0 && cacheTime >= modTime) {
+		return
+	}
+	client := newClient()
 	// 获取Dnspod已有配置,设置备注并缓存
 	var success = true
-	var limit uint64 = 3000
+	discoverDomains(client)
 	for domain, subDomains := range config.Domains {
-		s := strings.Split(subDomains[0], "#")
-		section := dbh.Section(domain, s[0])
-		if len(section.List()) < 1 || cacheTime < modTime {
-			fmt.Printf("[%s] cache timeout\n", time.Now().Format("2006-01-02 15:04:05"))
-			describeDomainRequest := dnspod.NewDescribeDomainRequest()
-			describeDomainRequest.Domain = &domain
-			<-rateLimiter
-			describeDomainResponse, err := client.DescribeDomain(describeDomainRequest)
-			var tencentCloudSDKError *tencentErrors.TencentCloudSDKError
-			if errors.As(err, &tencentCloudSDKError) {
-				fmt.Printf("An API error has returned: %s", err)
-				continue
+		// 通配符每次运行都按最新的记录列表展开
+		patterns := hasPatterns(subDomains)
+		probe := "@"
+		if len(subDomains) > 0 && !patterns {
+			_, probe = parseSubdomain(subDomains[0])
+		} else if len(config.Records[domain]) > 0 {
+			probe = config.Records[domain][0].Name
+		}
+		section := dbh.Section(domain, probe)
+		stale := cacheTime < modTime || refreshPending(dbh)[domain] || !patterns && len(section.List()) < 1
+		if stale || patterns {
+			domainInfo := &dnspod.DomainInfo{}
+			if !stale && cacheGet(dbh.Section(), domain, &domainInfo) == nil {
+				fmt.Printf("[%s] expanding subdomains of %s\n", time.Now().Format("2006-01-02 15:04:05"), domain)
+			} else {
+				fmt.Printf("[%s] cache timeout\n", time.Now().Format("2006-01-02 15:04:05"))
+				domainInfo, err = describeDomain(domain, client)
+				if err != nil {
+					fmt.Printf("An API error has returned: %s", err)
+					success = false
+					markFailed()
+					continue
+				}
+				_ = cachePut(dbh.Section(), domain, "DescribeDomain", domainInfo)
 			}
-			if describeDomainResponse == nil || describeDomainResponse.Response == nil || describeDomainResponse.Response.DomainInfo == nil {
-				fmt.Printf("Empty DomainInfo returned: %v", describeDomainResponse)
-				continue
+			// 空域名也继续, 以便创建第一条记录
+			names := managedNames(domain, subDomains)
+			if patterns {
+				// 通配符需要完整的记录列表
+				names = nil
 			}
-			domainInfo := describeDomainResponse.Response.DomainInfo
-
-			_ = dbh.Put(domainInfo, domain)
-			describeRecordListRequest := dnspod.NewDescribeRecordListRequest()
-			describeRecordListRequest.Domain = &domain
-			describeRecordListRequest.Limit = &limit
-			<-rateLimiter
-			describeRecordListResponse, err := client.DescribeRecordList(describeRecordListRequest)
-			if errors.As(err, &tencentCloudSDKError) {
+			records, err := listDomainRecords(domain, names, client)
+			if err != nil {
 				fmt.Printf("An API error has returned: %s", err)
+				success = false
 				continue
 			}
-			if describeRecordListResponse == nil || describeRecordListResponse.Response == nil || len(describeRecordListResponse.Response.RecordList) < 1 {
-				fmt.Printf("Empty RecordList returned: %v", describeRecordListResponse)
-				continue
+			if patterns {
+				subDomains = expandSubdomains(domain, subDomains, records)
 			}
-
-			records := describeRecordListResponse.Response.RecordList
+			managedSubdomains := subdomainNames(subDomains)
 
 			wg := sync.WaitGroup{}
+			taken := make(map[string]bool)
+			// 刷新的记录集合先清空, 避免保留已不存在的记录
+			refreshed := make(map[string]bool)
+			resetSet := func(section *db.Section, subDomain, key string) {
+				if !refreshed[subDomain+"/"+key] {
+					refreshed[subDomain+"/"+key] = true
+					_ = section.RemoveItem(key)
+				}
+			}
+			var adopting []*dnspod.RecordListItem
 			for _, record := range records {
-				if strings.ToUpper(*record.Status) == `ENABLE` && contains(subDomains, *record.Name) {
-					recordId := *record.Type + "-" + *record.Remark
-					recordCounter[recordId+"."+domain]++
+				managed := managedSubdomains[*record.Name]
+				if managed || templateNamed(domain, *record.Name) {
 					section := dbh.Section(domain, *record.Name)
-					if *record.Remark != "" {
-						// 更新记录缓存
+					if name, ok := ownedRemark(*record.Remark); ok {
+						// 更新记录缓存, 包括已停用的托管记录
+						taken[*record.Name+"/"+*record.Type+"/"+name] = true
+						taken[*record.Name+"/"+*record.Type+"/"+name+"/"+*record.Value] = true
+						resetSet(section, *record.Name, *record.Type+"-"+name)
+						// 列表中已有完整的记录信息, 无需逐条 DescribeRecord
+						cacheRecord(section, *record.Type+"-"+name, "DescribeRecordList", listItemInfo(record, domainInfo.DomainId))
+						continue
+					}
+					if !managed || strings.ToUpper(*record.Status) != `ENABLE` {
+						continue
+					}
+					_, bare := config.Ips[*record.Remark]
+					if !adoptable(domain, *record.Name) || (*record.Remark != "" && !bare) {
+						fmt.Printf("[%s] skip unmanaged %s.%s[%s] %s\n", time.Now().Format("2006-01-02 15:04:05"), *record.Name, domain, *record.Remark, *record.Value)
+						continue
+					}
+					if bare {
+						// 备注与名称一致但缺少前缀, 补写前缀
+						taken[*record.Name+"/"+*record.Type+"/"+*record.Remark] = true
+						taken[*record.Name+"/"+*record.Type+"/"+*record.Remark+"/"+*record.Value] = true
+						resetSet(section, *record.Name, *record.Type+"-"+*record.Remark)
 						wg.Add(1)
-						go makeRecordCache(client, domainInfo, record.RecordId, section, record.Remark, &wg)
-					} else {
-						remark := remarkNames[recordCounter[recordId+"."+domain]-1]
-						fmt.Printf("[%s] Updating %s.%s with remark %s\n", time.Now().Format("2006-01-02 15:04:05"), *record.Name, domain, remark) // 未有此记录,需要更新
-						modifyRecordRemarkRequest := dnspod.NewModifyRecordRemarkRequest()
-						modifyRecordRemarkRequest.Domain = &domain
-						modifyRecordRemarkRequest.Remark = &remark
-						modifyRecordRemarkRequest.RecordId = record.RecordId
-						<-rateLimiter
-						_, err := client.ModifyRecordRemark(modifyRecordRemarkRequest)
-						if err != nil {
-							fmt.Printf("update failed: %s\n", err)
-						} else {
-							wg.Add(1)
-							go makeRecordCache(client, domainInfo, record.RecordId, section, &remark, &wg)
-						}
+						go adoptRecord(client, domainInfo, record, section, *record.Remark, &wg)
+						continue
 					}
+					adopting = append(adopting, record)
+				}
+			}
+			assigned := assignRemarks(domain, subDomains, adopting, taken, remarks)
+			for _, record := range adopting {
+				if name, ok := assigned[*record.RecordId]; ok {
+					section := dbh.Section(domain, *record.Name)
+					resetSet(section, *record.Name, *record.Type+"-"+name)
+					wg.Add(1)
+					go adoptRecord(client, domainInfo, record, section, name, &wg)
 				}
 			}
 			wg.Wait()
+			clearRefresh(dbh, domain)
 
-			checkDns(subDomains, &dbh, domain, remarks, domainInfo, client)
+			checkDns(subDomains, dbh, domain, remarks, domainInfo, client)
+			checkTemplateRecords(dbh, domain, remarks, domainInfo, client)
 			//domainsInfo, _, _ := client.Domains.List(&dnspod.DomainSearchParam{Keyword: domain})
 			//if len(domainsInfo) > 0 && domain == domainsInfo[0].Name {
 			//	_ = dbh.Put(domainsInfo[0], domain)
@@ -192,69 +323,135 @@ func main() {
 		} else {
 			fmt.Printf("[%s] cache used\n", time.Now().Format("2006-01-02 15:04:05"))
 			domainInfo := &dnspod.DomainInfo{}
-			err = dbh.Get(&domainInfo, domain)
+			err = cacheGet(dbh.Section(), domain, &domainInfo)
 			if err != nil {
 				fmt.Printf("[%s] get %s info failed\n", time.Now().Format("2006-01-02 15:04:05"), domain)
 				success = false
 				continue
 			}
-			checkDns(subDomains, &dbh, domain, remarks, domainInfo, client)
+			checkDns(subDomains, dbh, domain, remarks, domainInfo, client)
+			checkTemplateRecords(dbh, domain, remarks, domainInfo, client)
 		}
 	}
+	if config.Prune.Enabled {
+		pruneRecords(dbh, client)
+	}
 	// success and put cacheTime
 	if success {
 		_ = dbh.Put(time.Now().Unix(), "cacheTime")
+		savePublished(dbh, remarks)
 	} else {
 		_ = dbh.Put(0, "cacheTime")
+		_ = dbh.RemoveItem("published")
 	}
 	fmt.Printf("[%s] end\n", time.Now().Format("2006-01-02 15:04:05"))
 }
 
-func checkDns(subDomains []string, db *db.DB, domain string, remarks map[string]string, domainInfo *dnspod.DomainInfo, client *dnspod.Client) {
+func openCache() (*db.DB, error) {
+	switch *storage {
+	case "file":
+		return &db.DB{Root: *cachePath}, nil
+	case "bolt":
+		return db.OpenBolt(*cachePath + ".db")
+	}
+	return nil, fmt.Errorf("unknown storage %s", *storage)
+}
+
+func migrateCache() error {
+	src := &db.DB{Root: *cachePath}
+	dst, err := db.OpenBolt(*cachePath + ".db")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dst.Close() }()
+	if err := db.Copy(dst, src); err != nil {
+		return err
+	}
+	fmt.Printf("[%s] migrated %s to %s.db, run with -s bolt\n", time.Now().Format("2006-01-02 15:04:05"), *cachePath, *cachePath)
+	return nil
+}
+
+func checkDns(subDomains []string, db *db.DB, domain string, remarks map[string]*addresses, domainInfo *dnspod.DomainInfo, client *dnspod.Client) {
 	fmt.Printf("[%s] check domain %s %v\n", time.Now().Format("2006-01-02 15:04:05"), domain, subDomains)
 	for _, subDomain := range subDomains {
 		rmk, subDomain := parseSubdomain(subDomain)
 		section := db.Section(domain, subDomain)
 		createWg := sync.WaitGroup{}
 		updateWg := sync.WaitGroup{}
-		for remark, ip := range remarks {
-			if ( len(rmk) > 0 || strings.HasPrefix(remark, ".")) && rmk != remark {
+		active := activeRemarks(domain, subDomain, subdomainRemarks(subDomains, subDomain), remarks)
+		for remark, addrs := range remarks {
+			if (len(rmk) > 0 || strings.HasPrefix(remark, ".")) && rmk != remark {
 				continue
 			}
-			// 本地无缓存
-			var record dnspod.RecordInfo
-			lSubDomain := subDomain
-			lIp := ip
-			lRemark := remark
-			dnsType := getDNSType(ip)
-			if config.HttpRecord && dnsType == "A" {
-				var record dnspod.RecordInfo
-				lSubDomain := subDomain
-				lIp := ip
-				lRemark := remark
-				recordId := "HTTPS" + "-" + remark
-				if err := section.Get(recordId, &record); err != nil {
-					createWg.Add(1)
-					go createHttpsRecord(&lSubDomain, domainInfo, &lIp, client, section, &lRemark, &createWg)
-				} else if !strings.Contains(*record.Value, lIp) && record.Id != nil { // 本地有缓存且IP已改变
-					updateWg.Add(1)
-					go updateHttpsRecord(&lSubDomain, domainInfo, &lIp, client, &record, section, &lRemark, &updateWg)
+			if isPaused(db, domain, subDomain, remark) {
+				// disable 命令停用的记录保持停用
+				for _, dnsType := range append(recordFamilies, "HTTPS") {
+					pauseRecordSet(section, subDomain, dnsType+"-"+remark, domainInfo, client)
 				}
+				continue
+			}
+			if active != nil && !active[remark] {
+				withdrawRemark(section, subDomain, remark, domainInfo, client)
+				continue
 			}
-			recordId := dnsType + "-" + remark
-			if err := section.Get(recordId, &record); err != nil {
+			addrs := addrs.forSubdomain(domain, subDomain)
+			for _, dnsType := range recordFamilies {
+				ips, ok := addrs.ips[dnsType]
+				if !ok {
+					if addrs.failed[dnsType] {
+						continue
+					}
+					// 该协议族已无地址
+					handleLostRecord(section, subDomain, dnsType+"-"+remark, domainInfo, client)
+					continue
+				}
+				syncRecordSet(section, subDomain, remark, dnsType, ips, domainInfo, client, &createWg, &updateWg)
+			}
+			if !httpsEnabled(domain, subDomain) {
+				// 已关闭 HTTPS 记录的子域名删除此前发布的记录
+				removeRecordSet(section, subDomain, "HTTPS-"+remark, domainInfo, client)
+				continue
+			}
+			if len(addrs.ips["A"]) == 0 && len(addrs.ips["AAAA"]) == 0 {
+				if !addrs.failed["A"] && !addrs.failed["AAAA"] {
+					handleLostRecord(section, subDomain, "HTTPS-"+remark, domainInfo, client)
+				}
+				continue
+			}
+			lSubDomain := subDomain
+			lRemark := remark
+			recordId := "HTTPS" + "-" + remark
+			set, err := getRecordSet(section, recordId)
+			if err != nil || len(set) == 0 {
+				svcb := buildSvcb(domain, subDomain, addrs.ips["A"], addrs.ips["AAAA"])
 				createWg.Add(1)
-				go createRecord(&lSubDomain, domainInfo, &lIp, client, section, &lRemark, &createWg)
-			} else if lIp != *record.Value && record.Id != nil { // 本地有缓存且IP已改变
+				go createHttpsRecord(&lSubDomain, domainInfo, svcb, client, section, &lRemark, &createWg)
+				continue
+			}
+			record := set[0]
+			cached := cachedSvcb(record.MX, record.Value)
+			v4, v6 := addrs.ips["A"], addrs.ips["AAAA"]
+			// 获取失败的协议族沿用已发布的 hint
+			if addrs.failed["A"] && cached != nil && cached.Params["ipv4hint"] != "" {
+				v4 = strings.Split(cached.Params["ipv4hint"], ",")
+			}
+			if addrs.failed["AAAA"] && cached != nil && cached.Params["ipv6hint"] != "" {
+				v6 = strings.Split(cached.Params["ipv6hint"], ",")
+			}
+			svcb := buildSvcb(domain, subDomain, v4, v6)
+			// ECH 文件读取失败时沿用已发布的配置
+			if svcb.Priority != 0 && echUnavailable(domain, subDomain) && cached != nil && cached.Params["ech"] != "" {
+				svcb.Params["ech"] = cached.Params["ech"]
+			}
+			if restoreRecord(section, record, lRemark, domainInfo, client) && (cached == nil || !cached.Equal(svcb)) && record.Id != nil { // 本地有缓存且参数已改变
 				updateWg.Add(1)
-				go updateRecord(&lSubDomain, domainInfo, &lIp, client, &record, section, &lRemark, &updateWg)
-			} else {
-				fmt.Printf("[%s] %s.%s[%s] IP无变化\n", time.Now().Format("2006-01-02 15:04:05"), lSubDomain, domain, lRemark)
+				go updateHttpsRecord(&lSubDomain, domainInfo, svcb, client, record, section, &lRemark, &updateWg)
 			}
 		}
 		createWg.Wait()
 		updateWg.Wait()
 	}
+	flushBatch(domainInfo, client)
 }
 
 func updateRecord(subDomain *string, domainInfo *dnspod.DomainInfo, ip *string, client *dnspod.Client, record *dnspod.RecordInfo, section *db.Section, remark *string, wg *sync.WaitGroup) {
@@ -271,25 +468,12 @@ func updateRecord(subDomain *string, domainInfo *dnspod.DomainInfo, ip *string,
 	modifyRecordRequest.SubDomain = subDomain
 	modifyRecordRequest.RecordLineId = record.RecordLineId
 	modifyRecordRequest.Remark = record.Remark
-	<-rateLimiter
-	response, err := client.ModifyRecord(modifyRecordRequest)
+	var response *dnspod.ModifyRecordResponse
+	err := modifyRetrying(domainInfo, record, section, *remark, client, func() (err error) {
+		response, err = modifyRecord(modifyRecordRequest, record, client)
+		return err
+	})
 	if err != nil {
-		if sdkErr, ok := err.(*tencentErrors.TencentCloudSDKError); ok && sdkErr.Code == "LimitExceeded.SubdomainRollLimit" {
-			fmt.Printf("LimitExceeded.SubdomainRollLimit 错误，RequestId: %s\n", sdkErr.RequestId)
-			duplicateRecordIds, err := getDuplicateRecordIdsBySubdomainAndRemark(domainInfo.Domain, record, client)
-			if err != nil {
-				fmt.Printf("getDuplicateRecordIdBySubdomainAndRemark failed: %s\n", err)
-			} else {
-				for _, duplicateRecordId := range duplicateRecordIds {
-					fmt.Printf("duplicateRecordId: %d\n", *duplicateRecordId)
-					err := deleteRecord(domainInfo.Domain, duplicateRecordId, client)
-					if err != nil {
-						fmt.Printf("deleteRecord failed: %s\n", err)
-					}
-				}
-				updateHttpsRecord(subDomain, domainInfo, ip, client, record, section, remark, nil)
-			}
-		}
 		fmt.Printf("update failed: %s\n,%v\n", err, response)
 		req, _ := json.Marshal(modifyRecordRequest)
 		fmt.Printf("modifyRecordRequest: %s\n", req)
@@ -297,15 +481,14 @@ func updateRecord(subDomain *string, domainInfo *dnspod.DomainInfo, ip *string,
 		makeRecordCache(client, domainInfo, record.Id, section, remark, nil)
 	}
 }
-func updateHttpsRecord(subDomain *string, domainInfo *dnspod.DomainInfo, ip *string, client *dnspod.Client, record *dnspod.RecordInfo, section *db.Section, remark *string, wg *sync.WaitGroup) {
+
+func updateHttpsRecord(subDomain *string, domainInfo *dnspod.DomainInfo, svcb *svcbRecord, client *dnspod.Client, record *dnspod.RecordInfo, section *db.Section, remark *string, wg *sync.WaitGroup) {
 	if wg != nil {
 		defer wg.Done()
 	}
 
-	value := fmt.Sprintf(`%s.%s. alpn="h3" ipv4hint="%s" port="%s"`, *subDomain, *domainInfo.Domain, *ip, config.H3Port)
-	if *subDomain == "@" {
-		value = fmt.Sprintf(`%s. alpn="h3" ipv4hint="%s" port="%s"`, *domainInfo.Domain, *ip, config.H3Port)
-	}
+	value := svcb.Value()
+	priority := svcb.Priority
 
 	fmt.Printf("[%s] Updating %s.%s[%s], value:%s\n", time.Now().Format("2006-01-02 15:04:05"), *subDomain, *domainInfo.Domain, *remark, value)
 
@@ -313,32 +496,18 @@ func updateHttpsRecord(subDomain *string, domainInfo *dnspod.DomainInfo, ip *str
 	modifyRecordRequest.Domain = domainInfo.Domain
 	modifyRecordRequest.RecordType = record.RecordType
 	modifyRecordRequest.RecordLine = record.RecordLine
-	modifyRecordRequest.MX = record.MX
+	modifyRecordRequest.MX = &priority
 	modifyRecordRequest.Value = &value
 	modifyRecordRequest.RecordId = record.Id
 	modifyRecordRequest.SubDomain = subDomain
 	modifyRecordRequest.RecordLineId = record.RecordLineId
 	modifyRecordRequest.Remark = record.Remark
-	<-rateLimiter
-	response, err := client.ModifyRecord(modifyRecordRequest)
+	var response *dnspod.ModifyRecordResponse
+	err := modifyRetrying(domainInfo, record, section, *remark, client, func() (err error) {
+		response, err = modifyRecord(modifyRecordRequest, record, client)
+		return err
+	})
 	if err != nil {
-		// 判断是否为 TencentCloudSDKError 并且 code 是 LimitExceeded.SubdomainRollLimit
-		if sdkErr, ok := err.(*tencentErrors.TencentCloudSDKError); ok && sdkErr.Code == "LimitExceeded.SubdomainRollLimit" {
-			fmt.Printf("LimitExceeded.SubdomainRollLimit 错误，RequestId: %s\n", sdkErr.RequestId)
-			duplicateRecordIds, err := getDuplicateRecordIdsBySubdomainAndRemark(domainInfo.Domain, record, client)
-			if err != nil {
-				fmt.Printf("getDuplicateRecordIdBySubdomainAndRemark failed: %s\n", err)
-			} else {
-				for _, duplicateRecordId := range duplicateRecordIds {
-					fmt.Printf("duplicateRecordId: %d\n", *duplicateRecordId)
-					err := deleteRecord(domainInfo.Domain, duplicateRecordId, client)
-					if err != nil {
-						fmt.Printf("deleteRecord failed: %s\n", err)
-					}
-				}
-				updateHttpsRecord(subDomain, domainInfo, ip, client, record, section, remark, nil)
-			}
-		}
 		fmt.Printf("update failed: %s\n,%v\n", err, response)
 		req, _ := json.Marshal(modifyRecordRequest)
 		fmt.Printf("modifyRecordRequest: %s\n", req)
@@ -358,9 +527,9 @@ func createRecord(subDomain *string, domainInfo *dnspod.DomainInfo, ip *string,
 	createRecordRequest.RecordType = &recordType
 	createRecordRequest.RecordLine = &recordLine
 	createRecordRequest.Value = ip
-	createRecordRequest.Remark = remark
-	<-rateLimiter
-	createRecordResponse, err := client.CreateRecord(createRecordRequest)
+	dnsRemark := recordRemark(*remark)
+	createRecordRequest.Remark = &dnsRemark
+	createRecordResponse, err := addRecord(createRecordRequest, client)
 	var tencentCloudSDKError *tencentErrors.TencentCloudSDKError
 	if errors.As(err, &tencentCloudSDKError) {
 		fmt.Printf("An API error has returned: %s\n", err)
@@ -378,29 +547,26 @@ func createRecord(subDomain *string, domainInfo *dnspod.DomainInfo, ip *string,
 	}
 }
 
-func createHttpsRecord(subDomain *string, domainInfo *dnspod.DomainInfo, ip *string, client *dnspod.Client, section *db.Section, remark *string, wg *sync.WaitGroup) {
+func createHttpsRecord(subDomain *string, domainInfo *dnspod.DomainInfo, svcb *svcbRecord, client *dnspod.Client, section *db.Section, remark *string, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	value := fmt.Sprintf(`%s.%s. alpn="h3" ipv4hint="%s" port="%s"`, *subDomain, *domainInfo.Domain, *ip, config.H3Port)
-	if *subDomain == "@" {
-		value = fmt.Sprintf(`%s. alpn="h3" ipv4hint="%s" port="%s"`, *domainInfo.Domain, *ip, config.H3Port)
-	}
+	value := svcb.Value()
 
 	fmt.Printf("[%s] creating %s.%s[%s] , value:%s\n", time.Now().Format("2006-01-02 15:04:05"), *subDomain, *domainInfo.Domain, *remark, value) // 未有此记录,需要创建
 
 	recordType := "HTTPS"
 	recordLine := "默认"
-	var mx uint64 = 1
+	mx := svcb.Priority
 	createRecordRequest := dnspod.NewCreateRecordRequest()
 	createRecordRequest.SubDomain = subDomain
 	createRecordRequest.Domain = domainInfo.Domain
 	createRecordRequest.RecordType = &recordType
 	createRecordRequest.RecordLine = &recordLine
 	createRecordRequest.Value = &value
-	createRecordRequest.Remark = remark
+	dnsRemark := recordRemark(*remark)
+	createRecordRequest.Remark = &dnsRemark
 	createRecordRequest.MX = &mx
-	<-rateLimiter
-	createRecordResponse, err := client.CreateRecord(createRecordRequest)
+	createRecordResponse, err := addRecord(createRecordRequest, client)
 	var tencentCloudSDKError *tencentErrors.TencentCloudSDKError
 	if errors.As(err, &tencentCloudSDKError) {
 		fmt.Printf("An API error has returned: %s\n", err)
@@ -418,17 +584,35 @@ func createHttpsRecord(subDomain *string, domainInfo *dnspod.DomainInfo, ip *str
 	}
 }
 
+// adoptRecord 为记录写入托管备注并按列表中的记录信息缓存
+func adoptRecord(client *dnspod.Client, domainInfo *dnspod.DomainInfo, record *dnspod.RecordListItem, section *db.Section, name string, wg *sync.WaitGroup) {
+	defer wg.Done()
+	remark := recordRemark(name)
+	fmt.Printf("[%s] Updating %s.%s with remark %s\n", time.Now().Format("2006-01-02 15:04:05"), *record.Name, *domainInfo.Domain, remark) // 未有此记录,需要更新
+	info := listItemInfo(record, domainInfo.DomainId)
+	err := modifyRemark(domainInfo.Domain, info, remark, client)
+	if err != nil {
+		fmt.Printf("update failed: %s\n", err)
+		return
+	}
+	adopted := *info
+	adopted.Remark = &remark
+	cacheRecord(section, *record.Type+"-"+name, "DescribeRecordList", &adopted)
+}
+
 func makeRecordCache(client *dnspod.Client, domainInfo *dnspod.DomainInfo, recordId *uint64, section *db.Section, remark *string, wg *sync.WaitGroup) {
 	if wg != nil {
 		defer wg.Done()
 	}
 	record, err := getRecordInfo(domainInfo.Domain, recordId, client)
 	if err != nil {
+		// 缓存未更新, 下次运行不能跳过
+		markFailed()
 		return
 	}
 	fmt.Printf("[%s] Cached [%s] %s.%s[%s]\n", time.Now().Format("2006-01-02 15:04:05"), *record.RecordType, *record.SubDomain, *domainInfo.Domain, *remark)
 	_recordId := *record.RecordType + "-" + *remark
-	_ = section.Put(_recordId, record)
+	cacheRecord(section, _recordId, "DescribeRecord", record)
 
 }
 
@@ -474,31 +658,97 @@ func getDNSType(value string) string {
 	return ""
 }
 
-func getDuplicateRecordIdsBySubdomainAndRemark(domain *string,record *dnspod.RecordInfo, client *dnspod.Client) ([]*uint64, error) {
-	describeRecordRequest := dnspod.NewDescribeRecordListRequest()
-	describeRecordRequest.DomainId = record.DomainId
-	describeRecordRequest.Domain = domain
-	describeRecordRequest.Subdomain = record.SubDomain
-	describeRecordRequest.RecordType = record.RecordType
-	<-rateLimiter
-	describeRecordResponse, err := client.DescribeRecordList(describeRecordRequest)
+func getDuplicateRecordsBySubdomainAndRemark(domain *string, record *dnspod.RecordInfo, client *dnspod.Client) ([]*dnspod.RecordListItem, error) {
+	list, err := listRecords(domain, *record.SubDomain, *record.RecordType, client)
 	if err != nil {
 		return nil, err
 	}
-	duplicateRecordIds := make([]*uint64, 0)
-	for _, _record := range describeRecordResponse.Response.RecordList {
-		if *_record.Remark == *record.Remark && *_record.RecordId != *record.Id {
-			duplicateRecordIds = append(duplicateRecordIds, _record.RecordId)
+	duplicates := make([]*dnspod.RecordListItem, 0)
+	for _, _record := range list {
+		if _record.Remark != nil && record.Remark != nil && *_record.Remark == *record.Remark && *_record.RecordId != *record.Id {
+			duplicates = append(duplicates, _record)
 		}
 	}
-	return duplicateRecordIds, nil
+	return duplicates, nil
 }
 
-func deleteRecord(domain *string, recordId *uint64, client *dnspod.Client) error {
+func deleteRecord(domain *string, record *dnspod.RecordInfo, client *dnspod.Client) error {
 	deleteRecordRequest := dnspod.NewDeleteRecordRequest()
 	deleteRecordRequest.Domain = domain
-	deleteRecordRequest.RecordId = recordId
+	deleteRecordRequest.RecordId = record.Id
+	<-rateLimiter
+	response, err := client.DeleteRecord(deleteRecordRequest)
+	if err != nil {
+		markFailed()
+	}
+	if err == nil && response != nil && response.Response != nil {
+		writeJournal("DeleteRecord", domain, record.Id, record, deleteRecordRequest, response.Response.RequestId)
+		auditChange(*domain, stringValue(record.SubDomain), auditRemark(record.Remark), stringValue(record.RecordType), "delete", stringValue(record.Value), "", record.Id)
+	}
+	return err
+}
+
+func modifyRecordStatus(domain *string, record *dnspod.RecordInfo, status string, client *dnspod.Client) error {
+	modifyRecordStatusRequest := dnspod.NewModifyRecordStatusRequest()
+	modifyRecordStatusRequest.Domain = domain
+	modifyRecordStatusRequest.RecordId = record.Id
+	modifyRecordStatusRequest.Status = &status
+	// 记录修改前的状态, record 可能随后被调用方更新
+	old := *record
 	<-rateLimiter
-	_, err := client.DeleteRecord(deleteRecordRequest)
+	response, err := client.ModifyRecordStatus(modifyRecordStatusRequest)
+	if err != nil {
+		markFailed()
+	}
+	if err == nil && response != nil && response.Response != nil {
+		writeJournal("ModifyRecordStatus", domain, record.Id, &old, modifyRecordStatusRequest, response.Response.RequestId)
+		auditChange(*domain, stringValue(old.SubDomain), auditRemark(old.Remark), stringValue(old.RecordType), strings.ToLower(status), stringValue(old.Value), stringValue(old.Value), old.Id)
+	}
+	return err
+}
+
+// modifyRecord 修改记录并记入运行日志, old 为修改前的记录
+func modifyRecord(request *dnspod.ModifyRecordRequest, old *dnspod.RecordInfo, client *dnspod.Client) (*dnspod.ModifyRecordResponse, error) {
+	<-rateLimiter
+	response, err := client.ModifyRecord(request)
+	if err != nil {
+		markFailed()
+	}
+	if err == nil && response != nil && response.Response != nil {
+		writeJournal("ModifyRecord", request.Domain, request.RecordId, old, request, response.Response.RequestId)
+		auditChange(*request.Domain, stringValue(request.SubDomain), auditRemark(request.Remark), stringValue(request.RecordType), "update", stringValue(old.Value), stringValue(request.Value), request.RecordId)
+	}
+	return response, err
+}
+
+// addRecord 创建记录并记入运行日志
+func addRecord(request *dnspod.CreateRecordRequest, client *dnspod.Client) (*dnspod.CreateRecordResponse, error) {
+	<-rateLimiter
+	response, err := client.CreateRecord(request)
+	if err != nil {
+		markFailed()
+	}
+	if err == nil && response != nil && response.Response != nil {
+		writeJournal("CreateRecord", request.Domain, response.Response.RecordId, nil, request, response.Response.RequestId)
+		auditChange(*request.Domain, stringValue(request.SubDomain), auditRemark(request.Remark), stringValue(request.RecordType), "create", "", stringValue(request.Value), response.Response.RecordId)
+	}
+	return response, err
+}
+
+// modifyRemark 修改记录备注并记入运行日志
+func modifyRemark(domain *string, old *dnspod.RecordInfo, remark string, client *dnspod.Client) error {
+	modifyRecordRemarkRequest := dnspod.NewModifyRecordRemarkRequest()
+	modifyRecordRemarkRequest.Domain = domain
+	modifyRecordRemarkRequest.Remark = &remark
+	modifyRecordRemarkRequest.RecordId = old.Id
+	<-rateLimiter
+	response, err := client.ModifyRecordRemark(modifyRecordRemarkRequest)
+	if err != nil {
+		markFailed()
+	}
+	if err == nil && response != nil && response.Response != nil {
+		writeJournal("ModifyRecordRemark", domain, old.Id, old, modifyRecordRemarkRequest, response.Response.RequestId)
+		auditChange(*domain, stringValue(old.SubDomain), auditRemark(&remark), stringValue(old.RecordType), "remark", stringValue(old.Remark), remark, old.Id)
+	}
 	return err
 }
@@ -0,0 +1,29 @@
+package main
+
+import "strings"
+
+// ownedRemark 返回 DNSPod 记录备注对应的 ips 名称, ok 表示记录由本工具管理.
+// 配置了 remarkPrefix 时以前缀标记归属, 否则备注须与 ips 中的名称或模板记录的名称一致
+func ownedRemark(remark string) (name string, ok bool) {
+	if config.RemarkPrefix != "" {
+		if !strings.HasPrefix(remark, config.RemarkPrefix) {
+			return "", false
+		}
+		name = strings.TrimPrefix(remark, config.RemarkPrefix)
+		return name, name != ""
+	}
+	if _, ok = config.Ips[remark]; !ok {
+		ok = isTemplateRemark(remark)
+	}
+	return remark, ok
+}
+
+// recordRemark 本工具写入 DNSPod 的记录备注
+func recordRemark(name string) string {
+	return config.RemarkPrefix + name
+}
+
+// adoptable 未标记归属的记录只有在 adopt 中显式列出时才会被接管
+func adoptable(domain, subDomain string) bool {
+	return contains(config.Adopt[domain], subDomain)
+}
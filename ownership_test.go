@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestOwnedRemark(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+
+	ips := map[string]IpSource{"telecom": {}, "unicom": {}}
+	records := map[string][]TemplateRecord{"example.com": {{Name: "mail", Type: "MX"}, {Name: "txt", Type: "TXT", Remark: "spf"}}}
+	tests := []struct {
+		name     string
+		prefix   string
+		remark   string
+		wantName string
+		wantOk   bool
+	}{
+		{"ips name", "", "telecom", "telecom", true},
+		{"default template remark", "", "tpl-mx", "tpl-mx", true},
+		{"template remark", "", "spf", "spf", true},
+		{"unknown remark", "", "manual", "manual", false},
+		{"empty remark", "", "", "", false},
+		{"prefixed", "ddns-", "ddns-telecom", "telecom", true},
+		{"prefixed name not in ips", "ddns-", "ddns-removed", "removed", true},
+		{"prefix only", "ddns-", "ddns-", "", false},
+		{"without prefix", "ddns-", "telecom", "", false},
+		{"prefix in the middle", "ddns-", "x-ddns-telecom", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config = Config{RemarkPrefix: tt.prefix, Ips: ips, Records: records}
+			name, ok := ownedRemark(tt.remark)
+			if name != tt.wantName || ok != tt.wantOk {
+				t.Errorf("ownedRemark(%q) = %q, %v, want %q, %v", tt.remark, name, ok, tt.wantName, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"dnspod-ddns/db"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// pausedKey 停用状态的键 域名/子域名/名称, 名称为空表示子域名下所有托管记录
+func pausedKey(domain, subDomain, remark string) string {
+	return domain + "/" + subDomain + "/" + remark
+}
+
+// isPaused 记录是否被 disable 命令停用, 同步时保持停用
+func isPaused(dbh *db.DB, domain, subDomain, remark string) bool {
+	paused := make(map[string]bool)
+	_ = dbh.Get(&paused, "paused")
+	return paused[pausedKey(domain, subDomain, remark)] || paused[pausedKey(domain, subDomain, "")]
+}
+
+// splitName 按配置中的域名拆分 子域名.域名, 匹配最长的域名
+func splitName(name string) (string, string, error) {
+	name = strings.TrimSuffix(name, ".")
+	var domains []string
+	for domain := range config.Domains {
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool { return len(domains[i]) > len(domains[j]) })
+	for _, domain := range domains {
+		if name == domain {
+			return domain, "@", nil
+		}
+		if strings.HasSuffix(name, "."+domain) {
+			return domain, strings.TrimSuffix(name, "."+domain), nil
+		}
+	}
+	return "", "", fmt.Errorf("%s is not in a domain of domains or domainSelect", name)
+}
+
+// pauseCommand disable/enable <子域名.域名> [名称]: 停用或启用托管记录并保存期望状态
+func pauseCommand(dbh *db.DB, client *dnspod.Client, disable bool, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: disable|enable <sub.domain> [remark]")
+	}
+	if len(config.DomainSelect) > 0 {
+		// domainSelect 选中的域名与正常运行时一致地加入 domains
+		discoverDomains(client)
+	}
+	domain, subDomain, err := splitName(args[0])
+	if err != nil {
+		return err
+	}
+	remark := ""
+	if len(args) == 2 {
+		remark = args[1]
+	}
+	paused := make(map[string]bool)
+	_ = dbh.Get(&paused, "paused")
+	key := pausedKey(domain, subDomain, remark)
+	if disable {
+		paused[key] = true
+	} else {
+		delete(paused, key)
+		if remark != "" && paused[pausedKey(domain, subDomain, "")] {
+			fmt.Printf("[%s] %s.%s is disabled as a whole, run enable without remark\n", time.Now().Format("2006-01-02 15:04:05"), subDomain, domain)
+		}
+	}
+	if err := dbh.Put(paused, "paused"); err != nil {
+		return err
+	}
+	// 下次运行须完整同步
+	_ = dbh.RemoveItem("published")
+	domainInfo := &dnspod.DomainInfo{}
+	if err := cacheGet(dbh.Section(), domain, &domainInfo); err != nil {
+		// 尚无缓存, 下次同步时生效
+		fmt.Printf("[%s] %s not cached, state applies on next sync\n", time.Now().Format("2006-01-02 15:04:05"), domain)
+		return nil
+	}
+	section := dbh.Section(domain, subDomain)
+	// 缓存中只有托管记录
+	for _, item := range section.List() {
+		if item.Subsection {
+			continue
+		}
+		_, name := splitRecordKey(item.Name)
+		if remark != "" && name != remark {
+			continue
+		}
+		if disable {
+			pauseRecordSet(section, subDomain, item.Name, domainInfo, client)
+		} else if !isPaused(dbh, domain, subDomain, name) {
+			set, _ := getRecordSet(section, item.Name)
+			for _, record := range set {
+				// 只启用由本程序停用的记录
+				if record.Id != nil && record.Enabled != nil && *record.Enabled == 0 && disabledByUs(dbh, domain, *record.Id) {
+					enableRecord(section, item.Name, record, domainInfo, client)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// pauseRecordSet 停用记录集合中仍启用的记录
+func pauseRecordSet(section *db.Section, subDomain, key string, domainInfo *dnspod.DomainInfo, client *dnspod.Client) {
+	set, _ := getRecordSet(section, key)
+	for _, record := range set {
+		if record.Id == nil || record.Enabled != nil && *record.Enabled == 0 {
+			continue
+		}
+		fmt.Printf("[%s] %s.%s[%s] paused, disabling %s\n", time.Now().Format("2006-01-02 15:04:05"), subDomain, *domainInfo.Domain, key, *record.Value)
+		disableRecord(section, key, record, domainInfo, client)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestSplitName(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config = Config{Domains: map[string][]string{
+		"example.com":     {"www"},
+		"lab.example.com": {"nas"},
+		"example.net":     {},
+	}}
+
+	check := func(name, wantDomain, wantSub string) {
+		t.Helper()
+		domain, sub, err := splitName(name)
+		if err != nil || domain != wantDomain || sub != wantSub {
+			t.Errorf("splitName(%q) = %q, %q, %v, want %q, %q", name, domain, sub, err, wantDomain, wantSub)
+		}
+	}
+	check("www.example.com", "example.com", "www")
+	check("a.b.example.com", "example.com", "a.b")
+	// 更长的域名优先, 子域名不会被拆到上级域名下
+	check("nas.lab.example.com", "lab.example.com", "nas")
+	check("lab.example.com", "lab.example.com", "@")
+	check("example.net.", "example.net", "@")
+
+	for _, name := range []string{"www.example.org", "badexample.com"} {
+		if _, _, err := splitName(name); err == nil {
+			t.Errorf("splitName(%q) should fail", name)
+		}
+	}
+}
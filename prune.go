@@ -0,0 +1,173 @@
+package main
+
+import (
+	"dnspod-ddns/db"
+	"fmt"
+	"strings"
+	"time"
+
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// PruneConfig 清理已从配置中移除的托管记录
+type PruneConfig struct {
+	Enabled bool   `json:"enabled"`
+	Action  string `json:"action"` // delete 或 disable, 默认 delete
+	Grace   string `json:"grace"`  // 记录失去配置后保留的时长, 如 "24h"
+	DryRun  bool   `json:"dryRun"` // 只输出将要执行的操作
+}
+
+// orphanState 孤立记录首次发现时间及是否已被停用
+type orphanState struct {
+	Since    int64 `json:"since"`
+	Disabled bool  `json:"disabled"`
+}
+
+// splitRecordKey 拆分缓存键 Type-Remark
+func splitRecordKey(key string) (recordType, remark string) {
+	s := strings.SplitN(key, "-", 2)
+	if len(s) < 2 {
+		return s[0], ""
+	}
+	return s[0], s[1]
+}
+
+// recordWanted 判断缓存中的托管记录是否仍由配置产生. 地址暂时消失的记录由 lostFamily 处理
+func recordWanted(domain, subDomain, key string) bool {
+	if templateWanted(domain, subDomain, key) {
+		return true
+	}
+	subDomains, ok := config.Domains[domain]
+	if !ok {
+		return false
+	}
+	recordType, remark := splitRecordKey(key)
+	if _, ok := config.Ips[remark]; !ok {
+		return false
+	}
+	selected := false
+	for _, s := range subDomains {
+		rmk, sub := parseSubdomain(s)
+		if sub != subDomain && !(isPattern(s) && patternMatches(sub, subDomain)) {
+			continue
+		}
+		if (len(rmk) > 0 || strings.HasPrefix(remark, ".")) && rmk != remark {
+			continue
+		}
+		selected = true
+	}
+	if !selected {
+		return false
+	}
+	if recordType == "HTTPS" {
+		return httpsEnabled(domain, subDomain)
+	}
+	return recordType == "A" || recordType == "AAAA"
+}
+
+// pruneRecords 删除或停用缓存中已不在配置内的托管记录. 首次发现时只记录时间, 超过宽限期后才处理
+func pruneRecords(dbh *db.DB, client *dnspod.Client) {
+	grace := time.Duration(0)
+	if config.Prune.Grace != "" {
+		var err error
+		grace, err = time.ParseDuration(config.Prune.Grace)
+		if err != nil {
+			fmt.Printf("[%s] invalid prune grace %s: %s\n", time.Now().Format("2006-01-02 15:04:05"), config.Prune.Grace, err)
+			return
+		}
+	}
+	action := config.Prune.Action
+	if action == "" {
+		action = "delete"
+	}
+	if action != "delete" && action != "disable" {
+		fmt.Printf("[%s] invalid prune action %s\n", time.Now().Format("2006-01-02 15:04:05"), action)
+		return
+	}
+	orphans := make(map[string]orphanState)
+	_ = dbh.Get(&orphans, "orphans")
+	now := time.Now()
+	seen := make(map[string]bool)
+	for _, d := range dbh.List() {
+		if !d.Subsection {
+			continue
+		}
+		domain := d.Name
+		for _, sub := range dbh.List(domain) {
+			if !sub.Subsection {
+				continue
+			}
+			section := dbh.Section(domain, sub.Name)
+			for _, item := range section.List() {
+				if item.Subsection {
+					continue
+				}
+				set, err := getRecordSet(section, item.Name)
+				if err != nil {
+					continue
+				}
+				wanted := recordWanted(domain, sub.Name, item.Name)
+				for _, record := range set {
+					// 缓存中只有本程序创建或接管的记录, 不再依据备注判断归属:
+					// 没有备注前缀时, 从 ips 删除的名称已不能通过备注识别
+					if record.Id == nil {
+						continue
+					}
+					name := fmt.Sprintf("%s/%s/%s/%d", domain, sub.Name, item.Name, *record.Id)
+					state, known := orphans[name]
+					if wanted {
+						if known && state.Disabled {
+							// 重新加入配置, 恢复之前停用的记录
+							fmt.Printf("[%s] prune: enabling %s.%s[%s] back\n", now.Format("2006-01-02 15:04:05"), sub.Name, domain, item.Name)
+							if !config.Prune.DryRun {
+								if err := modifyRecordStatus(&domain, record, "ENABLE", client); err != nil {
+									fmt.Printf("enable failed: %s\n", err)
+									seen[name] = true
+								}
+							}
+						}
+						continue
+					}
+					seen[name] = true
+					if !known {
+						state = orphanState{Since: now.Unix()}
+						orphans[name] = state
+					}
+					if state.Disabled {
+						continue
+					}
+					left := time.Unix(state.Since, 0).Add(grace).Sub(now)
+					if left > 0 {
+						fmt.Printf("[%s] prune: %s.%s[%s] no longer configured, %s in %s\n", now.Format("2006-01-02 15:04:05"), sub.Name, domain, item.Name, action, left.Round(time.Second))
+						continue
+					}
+					fmt.Printf("[%s] prune: %s %s.%s[%s] %s\n", now.Format("2006-01-02 15:04:05"), action, sub.Name, domain, item.Name, *record.Value)
+					if config.Prune.DryRun {
+						continue
+					}
+					if action == "disable" {
+						if err := modifyRecordStatus(&domain, record, "DISABLE", client); err != nil {
+							fmt.Printf("disable failed: %s\n", err)
+							continue
+						}
+						state.Disabled = true
+						orphans[name] = state
+						continue
+					}
+					if err := deleteRecord(&domain, record, client); err != nil {
+						fmt.Printf("deleteRecord failed: %s\n", err)
+						continue
+					}
+					uncacheRecord(section, item.Name, *record.Id)
+					delete(seen, name)
+				}
+			}
+		}
+	}
+	for name := range orphans {
+		if !seen[name] {
+			delete(orphans, name)
+		}
+	}
+	_ = dbh.Put(orphans, "orphans")
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestRecordWanted(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	disabled := false
+	config = Config{
+		Domains: map[string][]string{
+			"example.com": {"www", "api#unicom", "~*.lab", "@#.v6"},
+		},
+		Ips:     map[string]IpSource{"telecom": {}, "unicom": {}, ".v6": {}},
+		Records: map[string][]TemplateRecord{"example.com": {{Name: "mail", Type: "mx"}}},
+		Https: map[string]map[string]SvcbParams{
+			"example.com": {"*": {}, "api": {Enabled: &disabled}},
+		},
+		HttpRecord: true,
+	}
+
+	tests := []struct {
+		domain, sub, key string
+		want             bool
+	}{
+		{"example.com", "www", "A-telecom", true},
+		{"example.com", "www", "AAAA-unicom", true},
+		{"example.com", "www", "HTTPS-telecom", true},
+		{"example.com", "www", "CNAME-telecom", false},
+		{"example.com", "www", "A-removed", false},
+		{"example.com", "www", "A-.v6", false},
+		{"example.com", "api", "A-unicom", true},
+		{"example.com", "api", "A-telecom", false},
+		{"example.com", "api", "HTTPS-unicom", false},
+		{"example.com", "a.lab", "A-telecom", true},
+		{"example.com", "a.b.lab", "A-telecom", true},
+		{"example.com", "lab", "A-telecom", false},
+		{"example.com", "@", "AAAA-.v6", true},
+		{"example.com", "@", "A-telecom", false},
+		{"example.com", "mail", "MX-tpl-mx", true},
+		{"example.com", "mail", "A-telecom", false},
+		{"example.com", "old", "A-telecom", false},
+		{"removed.com", "www", "A-telecom", false},
+	}
+	for _, tt := range tests {
+		if got := recordWanted(tt.domain, tt.sub, tt.key); got != tt.want {
+			t.Errorf("recordWanted(%s, %s, %s) = %v, want %v", tt.domain, tt.sub, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestSplitRecordKey(t *testing.T) {
+	tests := []struct{ key, recordType, remark string }{
+		{"A-telecom", "A", "telecom"},
+		{"HTTPS-tpl-https", "HTTPS", "tpl-https"},
+		{"AAAA-.v6", "AAAA", ".v6"},
+		{"A", "A", ""},
+	}
+	for _, tt := range tests {
+		if recordType, remark := splitRecordKey(tt.key); recordType != tt.recordType || remark != tt.remark {
+			t.Errorf("splitRecordKey(%s) = %s, %s, want %s, %s", tt.key, recordType, remark, tt.recordType, tt.remark)
+		}
+	}
+}
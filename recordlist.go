@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+
+	tencentErrors "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// recordPageSize DescribeRecordList 单页的最大记录数
+const recordPageSize uint64 = 3000
+
+// filteredListMax 管理的子域名不超过该数量时按子域名分别查询, 否则分页获取整个域名的记录
+const filteredListMax = 3
+
+// listRecords 分页获取域名下的记录, subDomain/recordType 非空时由服务端过滤. 没有记录时返回空列表
+func listRecords(domain *string, subDomain, recordType string, client *dnspod.Client) ([]*dnspod.RecordListItem, error) {
+	var records []*dnspod.RecordListItem
+	var offset uint64
+	for {
+		request := dnspod.NewDescribeRecordListRequest()
+		request.Domain = domain
+		if subDomain != "" {
+			request.Subdomain = &subDomain
+		}
+		if recordType != "" {
+			request.RecordType = &recordType
+		}
+		limit := recordPageSize
+		pageOffset := offset
+		request.Offset = &pageOffset
+		request.Limit = &limit
+		<-rateLimiter
+		response, err := client.DescribeRecordList(request)
+		var sdkErr *tencentErrors.TencentCloudSDKError
+		if errors.As(err, &sdkErr) && sdkErr.Code == "ResourceNotFound.NoDataOfRecord" {
+			// 空域名或没有符合条件的记录
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if response == nil || response.Response == nil {
+			return records, nil
+		}
+		page := response.Response.RecordList
+		records = append(records, page...)
+		offset += uint64(len(page))
+		total := offset
+		// ListCount 为本页的记录数, TotalCount 才是符合条件的总数
+		if info := response.Response.RecordCountInfo; info != nil && info.TotalCount != nil {
+			total = *info.TotalCount
+		}
+		if uint64(len(page)) < limit || offset >= total {
+			return records, nil
+		}
+	}
+}
+
+// listDomainRecords 获取刷新缓存所需的记录: 只涉及少数子域名时按子域名过滤, 否则获取整个域名
+func listDomainRecords(domain string, names []string, client *dnspod.Client) ([]*dnspod.RecordListItem, error) {
+	if len(names) == 0 || len(names) > filteredListMax {
+		return listRecords(&domain, "", "", client)
+	}
+	var records []*dnspod.RecordListItem
+	for _, name := range names {
+		list, err := listRecords(&domain, name, "", client)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, list...)
+	}
+	return records, nil
+}
+
+// managedNames 域名下配置的子域名及模板记录名称
+func managedNames(domain string, subDomains []string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, s := range subDomains {
+		_, sub := parseSubdomain(s)
+		add(sub)
+	}
+	for _, t := range config.Records[domain] {
+		add(t.Name)
+	}
+	return names
+}
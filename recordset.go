@@ -0,0 +1,155 @@
+package main
+
+import (
+	"dnspod-ddns/db"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// recordSetGuard 串行化记录集合缓存的读改写, 同一集合的多条记录可能并发完成创建/修改
+var recordSetGuard sync.Mutex
+
+// getRecordSet 缓存中 类型-名称 对应的记录集合
+func getRecordSet(section *db.Section, key string) ([]*dnspod.RecordInfo, error) {
+	var set []*dnspod.RecordInfo
+	err := cacheGet(section, key, &set)
+	return set, err
+}
+
+// cacheRecord 将记录加入缓存中的记录集合, 已有同 Id 记录时替换
+func cacheRecord(section *db.Section, key, source string, record *dnspod.RecordInfo) {
+	recordSetGuard.Lock()
+	defer recordSetGuard.Unlock()
+	set, _ := getRecordSet(section, key)
+	replaced := false
+	for i, r := range set {
+		if r.Id != nil && record.Id != nil && *r.Id == *record.Id {
+			set[i] = record
+			replaced = true
+		}
+	}
+	if !replaced {
+		set = append(set, record)
+	}
+	_ = cachePut(section, key, source, set)
+}
+
+// uncacheRecord 从缓存的记录集合中移除记录
+func uncacheRecord(section *db.Section, key string, recordId uint64) {
+	recordSetGuard.Lock()
+	defer recordSetGuard.Unlock()
+	set, err := getRecordSet(section, key)
+	if err != nil {
+		return
+	}
+	kept := set[:0]
+	for _, r := range set {
+		if r.Id == nil || *r.Id != recordId {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == 0 {
+		_ = section.RemoveItem(key)
+		return
+	}
+	_ = cachePut(section, key, "DeleteRecord", kept)
+}
+
+// recordSetIds 记录集合中所有记录的 Id
+func recordSetIds(section *db.Section, key string) map[uint64]bool {
+	ids := make(map[uint64]bool)
+	set, _ := getRecordSet(section, key)
+	for _, r := range set {
+		if r.Id != nil {
+			ids[*r.Id] = true
+		}
+	}
+	return ids
+}
+
+// syncRecordSet 使 类型-名称 的记录集合与当前地址一致: 缺少的地址优先改写多余的记录, 不足时创建, 仍多余的记录删除
+func syncRecordSet(section *db.Section, subDomain, remark, dnsType string, ips []string, domainInfo *dnspod.DomainInfo, client *dnspod.Client, createWg, updateWg *sync.WaitGroup) {
+	key := dnsType + "-" + remark
+	set, _ := getRecordSet(section, key)
+	sort.Slice(set, func(i, j int) bool { return set[i].Id != nil && set[j].Id != nil && *set[i].Id < *set[j].Id })
+	wanted := make(map[string]bool)
+	for _, ip := range ips {
+		wanted[ip] = true
+	}
+	present := make(map[string]bool)
+	var stale []*dnspod.RecordInfo
+	for _, record := range set {
+		if record.Id == nil {
+			continue
+		}
+		if !restoreRecord(section, record, remark, domainInfo, client) {
+			// 无法启用的记录保持原样
+			present[*record.Value] = true
+			continue
+		}
+		if wanted[*record.Value] && !present[*record.Value] {
+			present[*record.Value] = true
+			continue
+		}
+		stale = append(stale, record)
+	}
+	changed := false
+	for _, ip := range ips {
+		if present[ip] {
+			continue
+		}
+		changed = true
+		lSubDomain := subDomain
+		lIp := ip
+		lRemark := remark
+		if len(stale) > 0 { // 本地有缓存且IP已改变
+			record := stale[0]
+			stale = stale[1:]
+			if batchEnabled() {
+				queueModify(pendingRecord{section: section, subDomain: subDomain, remark: remark, dnsType: dnsType, value: ip, record: record})
+				continue
+			}
+			updateWg.Add(1)
+			go updateRecord(&lSubDomain, domainInfo, &lIp, client, record, section, &lRemark, updateWg)
+		} else { // 本地无缓存
+			if batchEnabled() {
+				queueCreate(pendingRecord{section: section, subDomain: subDomain, remark: remark, dnsType: dnsType, value: ip})
+				continue
+			}
+			createWg.Add(1)
+			go createRecord(&lSubDomain, domainInfo, &lIp, client, section, &lRemark, createWg)
+		}
+	}
+	for _, record := range stale {
+		changed = true
+		fmt.Printf("[%s] deleting surplus %s.%s[%s] %s\n", time.Now().Format("2006-01-02 15:04:05"), subDomain, *domainInfo.Domain, key, *record.Value)
+		if err := deleteRecord(domainInfo.Domain, record, client); err != nil {
+			fmt.Printf("deleteRecord failed: %s\n", err)
+			continue
+		}
+		uncacheRecord(section, key, *record.Id)
+	}
+	if !changed {
+		fmt.Printf("[%s] %s.%s[%s] IP无变化\n", time.Now().Format("2006-01-02 15:04:05"), subDomain, *domainInfo.Domain, remark)
+	}
+}
+
+// removeRecordSet 删除缓存中 类型-名称 对应的全部记录
+func removeRecordSet(section *db.Section, subDomain, key string, domainInfo *dnspod.DomainInfo, client *dnspod.Client) {
+	set, _ := getRecordSet(section, key)
+	for _, record := range set {
+		if record.Id == nil {
+			continue
+		}
+		fmt.Printf("[%s] deleting %s.%s[%s] %s\n", time.Now().Format("2006-01-02 15:04:05"), subDomain, *domainInfo.Domain, key, *record.Value)
+		if err := deleteRecord(domainInfo.Domain, record, client); err != nil {
+			fmt.Printf("deleteRecord failed: %s\n", err)
+			continue
+		}
+		uncacheRecord(section, key, *record.Id)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"dnspod-ddns/db"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	tencentErrors "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// RollLimitConfig 修改记录遇到 LimitExceeded.SubdomainRollLimit 时对同名同备注重复记录的处理:
+// report(默认) 只报告, ask 在终端中逐条确认后删除, delete 直接删除. 删除的记录写入运行日志, 可用 rollback 恢复
+type RollLimitConfig struct {
+	Action string `json:"action"`
+}
+
+// rollLimitGuard 串行化终端中的确认提示
+var rollLimitGuard sync.Mutex
+
+// modifyRetrying 执行修改, 遇到 LimitExceeded.SubdomainRollLimit 时按 rollLimit 策略处理重复记录, 处理后只重试一次
+func modifyRetrying(domainInfo *dnspod.DomainInfo, record *dnspod.RecordInfo, section *db.Section, remark string, client *dnspod.Client, modify func() error) error {
+	err := modify()
+	var sdkErr *tencentErrors.TencentCloudSDKError
+	if !errors.As(err, &sdkErr) || sdkErr.Code != "LimitExceeded.SubdomainRollLimit" {
+		return err
+	}
+	fmt.Printf("LimitExceeded.SubdomainRollLimit 错误，RequestId: %s\n", sdkErr.RequestId)
+	if !resolveRollLimit(domainInfo, record, section, remark, client) {
+		return err
+	}
+	return modify()
+}
+
+// resolveRollLimit 处理与记录同名同备注、但不属于同一记录集合的重复记录, 返回是否有记录被删除
+func resolveRollLimit(domainInfo *dnspod.DomainInfo, record *dnspod.RecordInfo, section *db.Section, remark string, client *dnspod.Client) bool {
+	duplicates, err := getDuplicateRecordsBySubdomainAndRemark(domainInfo.Domain, record, client)
+	if err != nil {
+		fmt.Printf("getDuplicateRecordsBySubdomainAndRemark failed: %s\n", err)
+		return false
+	}
+	members := recordSetIds(section, *record.RecordType+"-"+remark)
+	removed := false
+	for _, duplicate := range duplicates {
+		if members[*duplicate.RecordId] {
+			// 同一记录集合中的其他地址
+			continue
+		}
+		fmt.Printf("[%s] duplicate %s.%s[%s] id %d value %s\n", time.Now().Format("2006-01-02 15:04:05"), *duplicate.Name, *domainInfo.Domain, *duplicate.Type, *duplicate.RecordId, *duplicate.Value)
+		if !confirmRollLimitDelete(duplicate) {
+			continue
+		}
+		if err := deleteRecord(domainInfo.Domain, listItemInfo(duplicate, domainInfo.DomainId), client); err != nil {
+			fmt.Printf("deleteRecord failed: %s\n", err)
+			continue
+		}
+		removed = true
+	}
+	return removed
+}
+
+// confirmRollLimitDelete 按 rollLimit 策略决定是否删除重复记录
+func confirmRollLimitDelete(duplicate *dnspod.RecordListItem) bool {
+	switch config.RollLimit.Action {
+	case "delete":
+		return true
+	case "ask":
+		rollLimitGuard.Lock()
+		defer rollLimitGuard.Unlock()
+		if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			fmt.Printf("not a terminal, keeping record %d\n", *duplicate.RecordId)
+			return false
+		}
+		fmt.Printf("delete record %d? [y/N] ", *duplicate.RecordId)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	default:
+		fmt.Printf("rollLimit action is report, keeping record %d\n", *duplicate.RecordId)
+		return false
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"dnspod-ddns/db"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// UnchangedConfig 地址未变化时跳过整次运行: 不创建客户端, 不调用任何接口.
+// 每 fullEvery 次运行或距上次完整同步超过 fullInterval 时仍执行完整同步, 默认每 60 次或 1 小时
+type UnchangedConfig struct {
+	Skip         bool   `json:"skip"`
+	FullEvery    int    `json:"fullEvery"`
+	FullInterval string `json:"fullInterval"`
+}
+
+// publishedState 上次完整同步时发布的内容
+type publishedState struct {
+	Remarks map[string]string `json:"remarks"` // ips 名称 -> 地址及状态
+	Values  map[string]string `json:"values"`  // 模板记录与 ECH 的值
+	FullAt  int64             `json:"fullAt"`
+	Skipped int               `json:"skipped"`
+}
+
+// runFailed 本次运行中有修改失败, 此时不保存发布状态
+var runFailed int32
+
+func markFailed() {
+	atomic.StoreInt32(&runFailed, 1)
+}
+
+// remarkSummary 名称获取到的地址及状态, 用于比较与记录历史
+func remarkSummary(addrs *addresses) string {
+	var parts []string
+	for _, dnsType := range recordFamilies {
+		switch {
+		case addrs.failed[dnsType]:
+			parts = append(parts, dnsType+":failed")
+		case len(addrs.ips[dnsType]) > 0:
+			parts = append(parts, dnsType+":"+strings.Join(addrs.ips[dnsType], ","))
+		}
+	}
+	if addrs.prefix != nil {
+		parts = append(parts, "prefix:"+addrs.prefix.String())
+	}
+	if addrs.unhealthy {
+		parts = append(parts, "unhealthy")
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
+// currentState 本地可得的全部发布内容, 不调用接口
+func currentState(remarks map[string]*addresses) publishedState {
+	state := publishedState{Remarks: make(map[string]string), Values: make(map[string]string)}
+	for name, addrs := range remarks {
+		state.Remarks[name] = remarkSummary(addrs)
+	}
+	for domain, records := range config.Records {
+		for _, t := range records {
+			value, err := templateValue(t, domain, remarks)
+			if err != nil {
+				value = "error: " + err.Error()
+			}
+			state.Values[domain+"/"+t.Name+"/"+strings.ToUpper(t.Type)+"-"+t.templateRemark()] = value
+		}
+	}
+	for domain, subs := range config.Https {
+		for sub, p := range subs {
+			if p.EchFile != "" {
+				value, _ := loadEch(p.EchFile)
+				state.Values[domain+"/"+sub+"/ech"] = value
+			}
+		}
+	}
+	return state
+}
+
+// canSkipRun 缓存有效且发布内容与上次完整同步一致时跳过本次运行
+func canSkipRun(dbh *db.DB, remarks map[string]*addresses, cacheFresh bool) bool {
+	if !config.Unchanged.Skip || !cacheFresh {
+		return false
+	}
+	var last publishedState
+	if err := dbh.Get(&last, "published"); err != nil {
+		return false
+	}
+	if len(refreshPending(dbh)) > 0 {
+		// 批量任务未确认的域名需要刷新缓存
+		return false
+	}
+	if config.Prune.Enabled {
+		// 等待宽限期的孤立记录需要继续检查
+		orphans := make(map[string]orphanState)
+		_ = dbh.Get(&orphans, "orphans")
+		if len(orphans) > 0 {
+			return false
+		}
+	}
+	fullEvery := config.Unchanged.FullEvery
+	if fullEvery <= 0 {
+		fullEvery = 60
+	}
+	fullInterval := time.Hour
+	if d, err := time.ParseDuration(config.Unchanged.FullInterval); err == nil && d > 0 {
+		fullInterval = d
+	}
+	if last.Skipped+1 >= fullEvery || time.Since(time.Unix(last.FullAt, 0)) >= fullInterval {
+		fmt.Printf("[%s] forcing full reconcile\n", time.Now().Format("2006-01-02 15:04:05"))
+		return false
+	}
+	current := currentState(remarks)
+	if !reflect.DeepEqual(current.Remarks, last.Remarks) || !reflect.DeepEqual(current.Values, last.Values) {
+		return false
+	}
+	last.Skipped++
+	_ = dbh.Put(last, "published")
+	fmt.Printf("[%s] nothing changed, skipping run\n", time.Now().Format("2006-01-02 15:04:05"))
+	return true
+}
+
+// savePublished 完整同步成功后保存发布内容
+func savePublished(dbh *db.DB, remarks map[string]*addresses) {
+	if atomic.LoadInt32(&runFailed) != 0 {
+		_ = dbh.RemoveItem("published")
+		return
+	}
+	state := currentState(remarks)
+	state.FullAt = time.Now().Unix()
+	_ = dbh.Put(state, "published")
+}
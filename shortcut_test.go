@@ -0,0 +1,111 @@
+package main
+
+import (
+	"dnspod-ddns/db"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRemarkSummary(t *testing.T) {
+	_, prefix, _ := net.ParseCIDR("2001:db8:1::/48")
+	tests := []struct {
+		name  string
+		addrs *addresses
+		want  string
+	}{
+		{"ipv4", ipv4("192.0.2.1", "192.0.2.2"), "A:192.0.2.1,192.0.2.2"},
+		{"both families", &addresses{ips: map[string][]string{"A": {"192.0.2.1"}, "AAAA": {"2001:db8::1"}}}, "A:192.0.2.1 AAAA:2001:db8::1"},
+		{"failed family", &addresses{ips: map[string][]string{"A": {"192.0.2.1"}}, failed: map[string]bool{"AAAA": true}}, "A:192.0.2.1 AAAA:failed"},
+		{"prefix", &addresses{ips: map[string][]string{}, prefix: prefix}, "prefix:2001:db8:1::/48"},
+		{"unhealthy", &addresses{ips: map[string][]string{"A": {"192.0.2.1"}}, unhealthy: true}, "A:192.0.2.1 unhealthy"},
+		{"nothing", &addresses{ips: map[string][]string{}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := remarkSummary(tt.addrs); got != tt.want {
+				t.Errorf("remarkSummary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentState(t *testing.T) {
+	saved, savedTemplates := config, templateCache
+	defer func() { config, templateCache = saved, savedTemplates }()
+	templateCache = make(map[string]templateEntry)
+	config = Config{Records: map[string][]TemplateRecord{"example.com": {
+		{Name: "spf", Type: "txt", Value: "v=spf1 ip4:{{ ip \"telecom\" }} -all"},
+		{Name: "alias", Type: "cname", Value: "{{ ip \"missing\" }}"},
+	}}}
+	state := currentState(map[string]*addresses{"telecom": ipv4("192.0.2.1")})
+	if got := state.Remarks["telecom"]; got != "A:192.0.2.1" {
+		t.Errorf("Remarks[telecom] = %q", got)
+	}
+	if got := state.Values["example.com/spf/TXT-tpl-txt"]; got != "v=spf1 ip4:192.0.2.1 -all" {
+		t.Errorf("Values[spf] = %q", got)
+	}
+	if got := state.Values["example.com/alias/CNAME-tpl-cname"]; got == "" || got[:6] != "error:" {
+		t.Errorf("Values[alias] = %q, want an error", got)
+	}
+}
+
+func TestCanSkipRun(t *testing.T) {
+	saved, savedTemplates := config, templateCache
+	defer func() { config, templateCache = saved, savedTemplates }()
+
+	remarks := map[string]*addresses{"telecom": ipv4("192.0.2.1")}
+	published := publishedState{
+		Remarks: map[string]string{"telecom": "A:192.0.2.1"},
+		Values:  map[string]string{},
+		FullAt:  time.Now().Unix(),
+	}
+	tests := []struct {
+		name    string
+		config  UnchangedConfig
+		fresh   bool
+		prepare func(dbh *db.DB)
+		want    bool
+	}{
+		{"unchanged", UnchangedConfig{Skip: true}, true, func(dbh *db.DB) { _ = dbh.Put(published, "published") }, true},
+		{"skip disabled", UnchangedConfig{}, true, func(dbh *db.DB) { _ = dbh.Put(published, "published") }, false},
+		{"cache stale", UnchangedConfig{Skip: true}, false, func(dbh *db.DB) { _ = dbh.Put(published, "published") }, false},
+		{"never published", UnchangedConfig{Skip: true}, true, func(dbh *db.DB) {}, false},
+		{"address changed", UnchangedConfig{Skip: true}, true, func(dbh *db.DB) {
+			changed := published
+			changed.Remarks = map[string]string{"telecom": "A:192.0.2.9"}
+			_ = dbh.Put(changed, "published")
+		}, false},
+		{"full run due by count", UnchangedConfig{Skip: true, FullEvery: 3}, true, func(dbh *db.DB) {
+			due := published
+			due.Skipped = 2
+			_ = dbh.Put(due, "published")
+		}, false},
+		{"full run due by time", UnchangedConfig{Skip: true, FullInterval: "10m"}, true, func(dbh *db.DB) {
+			due := published
+			due.FullAt = time.Now().Add(-time.Hour).Unix()
+			_ = dbh.Put(due, "published")
+		}, false},
+		{"domain refresh pending", UnchangedConfig{Skip: true}, true, func(dbh *db.DB) {
+			_ = dbh.Put(published, "published")
+			markRefresh(dbh, "example.com")
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templateCache = make(map[string]templateEntry)
+			config = Config{Unchanged: tt.config, Ips: map[string]IpSource{"telecom": {}}}
+			dbh := &db.DB{Root: t.TempDir()}
+			tt.prepare(dbh)
+			if got := canSkipRun(dbh, remarks, tt.fresh); got != tt.want {
+				t.Fatalf("canSkipRun() = %v, want %v", got, tt.want)
+			}
+			if tt.want {
+				var last publishedState
+				if err := dbh.Get(&last, "published"); err != nil || last.Skipped != 1 {
+					t.Errorf("published after skip = %+v, %v, want Skipped 1", last, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SvcbParams HTTPS 记录参数, 未配置的字段使用默认值: 优先级 1, alpn h3, 端口 h3Port, 目标为记录自身.
+// 子域名的配置覆盖域名下 "*" 的配置, enabled 未配置时使用全局 httpRecord
+type SvcbParams struct {
+	Enabled       *bool    `json:"enabled"`
+	Priority      *uint64  `json:"priority"`
+	Target        string   `json:"target"`
+	Alpn          []string `json:"alpn"`
+	NoDefaultAlpn bool     `json:"noDefaultAlpn"`
+	Port          *uint64  `json:"port"`
+	Ech           string   `json:"ech"`
+	// EchFile ECHConfigList 文件或密钥轮换目录, 每次运行重新读取, 优先于 ech
+	EchFile string `json:"echFile"`
+	NoHints bool   `json:"noHints"` // 不发布 ipv4hint/ipv6hint
+}
+
+// svcbKeyOrder SvcParam 的输出顺序(按 RFC 9460 中的 key 编号)
+var svcbKeyOrder = []string{"mandatory", "alpn", "no-default-alpn", "port", "ipv4hint", "ech", "ipv6hint"}
+
+// svcbRecord 解析后的 HTTPS/SVCB 记录, 优先级保存在 DNSPod 的 MX 字段
+type svcbRecord struct {
+	Priority uint64
+	Target   string
+	Params   map[string]string
+}
+
+// httpsParams 子域名的 HTTPS 参数, 未配置的字段使用域名下 "*" 的配置
+func httpsParams(domain, subDomain string) SvcbParams {
+	p := config.Https[domain]["*"]
+	if subDomain == "*" {
+		return p
+	}
+	o, ok := config.Https[domain][subDomain]
+	if !ok {
+		return p
+	}
+	if o.Enabled != nil {
+		p.Enabled = o.Enabled
+	}
+	if o.Priority != nil {
+		p.Priority = o.Priority
+	}
+	if o.Target != "" {
+		p.Target = o.Target
+	}
+	if o.Alpn != nil {
+		p.Alpn = o.Alpn
+	}
+	if o.Port != nil {
+		p.Port = o.Port
+	}
+	if o.Ech != "" || o.EchFile != "" {
+		p.Ech, p.EchFile = o.Ech, o.EchFile
+	}
+	p.NoDefaultAlpn = p.NoDefaultAlpn || o.NoDefaultAlpn
+	p.NoHints = p.NoHints || o.NoHints
+	return p
+}
+
+// httpsEnabled 子域名是否发布 HTTPS 记录
+func httpsEnabled(domain, subDomain string) bool {
+	if p := httpsParams(domain, subDomain); p.Enabled != nil {
+		return *p.Enabled
+	}
+	return config.HttpRecord
+}
+
+// buildSvcb 按配置与地址生成 HTTPS 记录
+func buildSvcb(domain, subDomain string, v4, v6 []string) *svcbRecord {
+	p := httpsParams(domain, subDomain)
+	r := &svcbRecord{Priority: 1, Target: p.Target, Params: make(map[string]string)}
+	if p.Priority != nil {
+		r.Priority = *p.Priority
+	}
+	if r.Target == "" {
+		r.Target = domain + "."
+		if subDomain != "@" {
+			r.Target = subDomain + "." + r.Target
+		}
+	}
+	if r.Priority == 0 {
+		// AliasMode 不带参数
+		return r
+	}
+	alpn := p.Alpn
+	if alpn == nil {
+		alpn = []string{"h3"}
+	}
+	if len(alpn) > 0 {
+		r.Params["alpn"] = strings.Join(alpn, ",")
+	}
+	if p.NoDefaultAlpn {
+		r.Params["no-default-alpn"] = ""
+	}
+	if p.Port != nil {
+		r.Params["port"] = strconv.FormatUint(*p.Port, 10)
+	} else if config.H3Port != "" {
+		r.Params["port"] = config.H3Port.String()
+	}
+	if p.EchFile != "" {
+		if ech, err := loadEch(p.EchFile); err == nil {
+			r.Params["ech"] = ech
+		}
+	} else if p.Ech != "" {
+		r.Params["ech"] = p.Ech
+	}
+	if !p.NoHints {
+		if len(v4) > 0 {
+			r.Params["ipv4hint"] = strings.Join(sortedCopy(v4), ",")
+		}
+		if len(v6) > 0 {
+			r.Params["ipv6hint"] = strings.Join(sortedCopy(v6), ",")
+		}
+	}
+	return r
+}
+
+func sortedCopy(values []string) []string {
+	s := append([]string(nil), values...)
+	sort.Strings(s)
+	return s
+}
+
+// Value DNSPod 记录值: 目标及按顺序排列的参数
+func (r *svcbRecord) Value() string {
+	parts := []string{r.Target}
+	keys := make([]string, 0, len(r.Params))
+	for key := range r.Params {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return svcbKeyIndex(keys[i]) < svcbKeyIndex(keys[j]) })
+	for _, key := range keys {
+		if r.Params[key] == "" {
+			parts = append(parts, key)
+		} else {
+			parts = append(parts, fmt.Sprintf(`%s="%s"`, key, r.Params[key]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func svcbKeyIndex(key string) int {
+	for i, k := range svcbKeyOrder {
+		if k == key {
+			return i
+		}
+	}
+	// keyNNNNN 等未知参数排在最后
+	return len(svcbKeyOrder)
+}
+
+// Equal 结构化比较, 忽略参数顺序、引号及 hint 地址顺序
+func (r *svcbRecord) Equal(o *svcbRecord) bool {
+	if r.Priority != o.Priority || !strings.EqualFold(r.Target, o.Target) || len(r.Params) != len(o.Params) {
+		return false
+	}
+	for key, value := range r.Params {
+		other, ok := o.Params[key]
+		if !ok {
+			return false
+		}
+		if key == "ipv4hint" || key == "ipv6hint" {
+			value = strings.Join(sortedCopy(strings.Split(value, ",")), ",")
+			other = strings.Join(sortedCopy(strings.Split(other, ",")), ",")
+		}
+		if value != other {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSvcb 解析 DNSPod 返回的 HTTPS 记录值
+func parseSvcb(priority uint64, value string) (*svcbRecord, error) {
+	fields, err := splitSvcbFields(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty svcb value")
+	}
+	r := &svcbRecord{Priority: priority, Target: fields[0], Params: make(map[string]string)}
+	for _, field := range fields[1:] {
+		key, val := field, ""
+		if idx := strings.Index(field, "="); idx >= 0 {
+			key, val = field[:idx], field[idx+1:]
+		}
+		key = strings.ToLower(key)
+		if _, ok := r.Params[key]; ok {
+			return nil, fmt.Errorf("duplicate svcb key %s", key)
+		}
+		r.Params[key] = val
+	}
+	return r, nil
+}
+
+// splitSvcbFields 按空白拆分并去除引号, 引号内可包含空白
+func splitSvcbFields(value string) ([]string, error) {
+	var fields []string
+	var cur strings.Builder
+	inQuote, inField := false, false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && i+1 < len(value):
+			i++
+			cur.WriteByte(value[i])
+			inField = true
+		case c == '"':
+			inQuote = !inQuote
+			inField = true
+		case (c == ' ' || c == '\t') && !inQuote:
+			if inField {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				inField = false
+			}
+		default:
+			cur.WriteByte(c)
+			inField = true
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote in %s", value)
+	}
+	if inField {
+		fields = append(fields, cur.String())
+	}
+	return fields, nil
+}
+
+// cachedSvcb 解析缓存中的 HTTPS 记录
+func cachedSvcb(priority *uint64, value *string) *svcbRecord {
+	if value == nil {
+		return nil
+	}
+	var p uint64
+	if priority != nil {
+		p = *priority
+	}
+	r, err := parseSvcb(p, *value)
+	if err != nil {
+		return nil
+	}
+	return r
+}
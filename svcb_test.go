@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSvcb(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		target  string
+		params  map[string]string
+		wantErr bool
+	}{
+		{"target only", ".", ".", map[string]string{}, false},
+		{"quoted params", `. alpn="h3,h2" port="443"`, ".", map[string]string{"alpn": "h3,h2", "port": "443"}, false},
+		{"flag param", ". no-default-alpn alpn=h3", ".", map[string]string{"no-default-alpn": "", "alpn": "h3"}, false},
+		{"upper case key", ". ALPN=h2", ".", map[string]string{"alpn": "h2"}, false},
+		{"quoted space", `. key65000="a b"`, ".", map[string]string{"key65000": "a b"}, false},
+		{"extra whitespace", "  svc.example.com.\t port=8443 ", "svc.example.com.", map[string]string{"port": "8443"}, false},
+		{"empty", "", "", nil, true},
+		{"duplicate key", ". port=1 port=2", "", nil, true},
+		{"unterminated quote", `. alpn="h3`, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseSvcb(1, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSvcb(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if r.Priority != 1 || r.Target != tt.target || !reflect.DeepEqual(r.Params, tt.params) {
+				t.Errorf("parseSvcb(%q) = %+v, want target %q params %v", tt.value, r, tt.target, tt.params)
+			}
+		})
+	}
+}
+
+func TestSvcbValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		record svcbRecord
+		want   string
+	}{
+		{"target only", svcbRecord{Target: "."}, "."},
+		{
+			"key order",
+			svcbRecord{Target: ".", Params: map[string]string{"ipv6hint": "::1", "port": "443", "alpn": "h3", "ipv4hint": "192.0.2.1"}},
+			`. alpn="h3" port="443" ipv4hint="192.0.2.1" ipv6hint="::1"`,
+		},
+		{"flag and unknown key", svcbRecord{Target: ".", Params: map[string]string{"key65000": "x", "no-default-alpn": ""}}, `. no-default-alpn key65000="x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.record.Value(); got != tt.want {
+				t.Errorf("Value() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSvcbValueRoundTrip(t *testing.T) {
+	r := &svcbRecord{Priority: 1, Target: ".", Params: map[string]string{"alpn": "h3,h2", "no-default-alpn": "", "ipv4hint": "192.0.2.1,192.0.2.2"}}
+	parsed, err := parseSvcb(1, r.Value())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Equal(parsed) {
+		t.Errorf("parseSvcb(%q) = %+v, want %+v", r.Value(), parsed, r)
+	}
+}
+
+func TestSvcbEqual(t *testing.T) {
+	base := func() *svcbRecord {
+		return &svcbRecord{Priority: 1, Target: "svc.example.com.", Params: map[string]string{"alpn": "h3", "ipv4hint": "192.0.2.1,192.0.2.2"}}
+	}
+	tests := []struct {
+		name   string
+		modify func(*svcbRecord)
+		want   bool
+	}{
+		{"same", func(r *svcbRecord) {}, true},
+		{"hint order", func(r *svcbRecord) { r.Params["ipv4hint"] = "192.0.2.2,192.0.2.1" }, true},
+		{"target case", func(r *svcbRecord) { r.Target = "SVC.Example.com." }, true},
+		{"priority", func(r *svcbRecord) { r.Priority = 2 }, false},
+		{"target", func(r *svcbRecord) { r.Target = "." }, false},
+		{"alpn order", func(r *svcbRecord) { r.Params["alpn"] = "h2,h3" }, false},
+		{"extra param", func(r *svcbRecord) { r.Params["port"] = "443" }, false},
+		{"missing param", func(r *svcbRecord) { delete(r.Params, "alpn") }, false},
+		{"replaced param", func(r *svcbRecord) { delete(r.Params, "alpn"); r.Params["port"] = "443" }, false},
+		{"hint changed", func(r *svcbRecord) { r.Params["ipv4hint"] = "192.0.2.1" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := base()
+			tt.modify(other)
+			if got := base().Equal(other); got != tt.want {
+				t.Errorf("Equal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
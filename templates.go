@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"dnspod-ddns/db"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	tencentErrors "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// TemplateRecord 任意类型的记录, 值由 text/template 模板根据当前获取到的 IP 生成.
+// 模板函数: ip 名称 [类型] 取第一个地址, ips 名称 [类型] 取逗号分隔的全部地址,
+// has 名称 [类型] 判断是否有地址, healthy 名称 判断线路健康检查是否通过, cmd 命令 取命令输出. 类型默认为 A
+type TemplateRecord struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Remark string `json:"remark"`
+	TTL    uint64 `json:"ttl"`
+	MX     uint64 `json:"mx"`
+}
+
+// templateRemark 模板记录用于归属与缓存的名称, 未配置时为 tpl-类型
+func (t TemplateRecord) templateRemark() string {
+	if t.Remark != "" {
+		return t.Remark
+	}
+	return "tpl-" + strings.ToLower(t.Type)
+}
+
+// isTemplateRemark 名称是否属于某个模板记录
+func isTemplateRemark(name string) bool {
+	for _, records := range config.Records {
+		for _, t := range records {
+			if t.templateRemark() == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// templateNamed 子域名是否配置了模板记录
+func templateNamed(domain, subDomain string) bool {
+	for _, t := range config.Records[domain] {
+		if t.Name == subDomain {
+			return true
+		}
+	}
+	return false
+}
+
+// templateWanted 缓存中的记录是否仍对应某个模板记录
+func templateWanted(domain, subDomain, key string) bool {
+	for _, t := range config.Records[domain] {
+		if t.Name == subDomain && strings.ToUpper(t.Type)+"-"+t.templateRemark() == key {
+			return true
+		}
+	}
+	return false
+}
+
+// templateCache 本次运行中已生成的模板值, 避免 cmd 等模板函数重复执行
+var (
+	templateCache = make(map[string]templateEntry)
+	templateGuard sync.Mutex
+)
+
+type templateEntry struct {
+	value string
+	err   error
+}
+
+// templateValue 生成模板记录的值, 同一运行中每条模板只生成一次
+func templateValue(t TemplateRecord, domain string, remarks map[string]*addresses) (string, error) {
+	key := domain + "/" + t.Name + "/" + strings.ToUpper(t.Type) + "-" + t.templateRemark()
+	templateGuard.Lock()
+	defer templateGuard.Unlock()
+	if e, ok := templateCache[key]; ok {
+		return e.value, e.err
+	}
+	value, err := renderTemplate(t, domain, remarks)
+	templateCache[key] = templateEntry{value, err}
+	return value, err
+}
+
+// renderTemplate 生成模板记录的值. 引用的名称没有地址时返回错误, 此时不修改记录
+func renderTemplate(t TemplateRecord, domain string, remarks map[string]*addresses) (string, error) {
+	lookup := func(name string, types []string) ([]string, error) {
+		addrs, ok := remarks[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown ips %s", name)
+		}
+		dnsType := "A"
+		if len(types) > 0 {
+			dnsType = types[0]
+		}
+		return addrs.forSubdomain(domain, t.Name).ips[dnsType], nil
+	}
+	funcs := template.FuncMap{
+		"ip": func(name string, types ...string) (string, error) {
+			ips, err := lookup(name, types)
+			if err != nil {
+				return "", err
+			}
+			if len(ips) == 0 {
+				return "", fmt.Errorf("no address for %s", name)
+			}
+			return ips[0], nil
+		},
+		"ips": func(name string, types ...string) (string, error) {
+			ips, err := lookup(name, types)
+			if err != nil {
+				return "", err
+			}
+			if len(ips) == 0 {
+				return "", fmt.Errorf("no address for %s", name)
+			}
+			return strings.Join(ips, ","), nil
+		},
+		"has": func(name string, types ...string) bool {
+			ips, err := lookup(name, types)
+			return err == nil && len(ips) > 0
+		},
+		"healthy": func(name string) bool {
+			addrs, ok := remarks[name]
+			return ok && !addrs.unhealthy
+		},
+		"cmd": func(cmd string) (string, error) {
+			out, err := runIpCommand(cmd)
+			return strings.TrimSpace(out), err
+		},
+	}
+	tpl, err := template.New(t.Name).Funcs(funcs).Parse(t.Value)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	data := map[string]string{"Domain": domain, "Name": t.Name}
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return normalizeValue(t.Type, buf.String()), nil
+}
+
+// normalizeValue 统一域名类记录值末尾的点, 便于与 DNSPod 返回值比较
+func normalizeValue(recordType, value string) string {
+	value = strings.TrimSpace(value)
+	switch strings.ToUpper(recordType) {
+	case "CNAME", "MX", "NS", "SRV":
+		if value != "" && !strings.HasSuffix(value, ".") {
+			value += "."
+		}
+	}
+	return value
+}
+
+// checkTemplateRecords 创建或更新域名下的模板记录
+func checkTemplateRecords(db *db.DB, domain string, remarks map[string]*addresses, domainInfo *dnspod.DomainInfo, client *dnspod.Client) {
+	wg := sync.WaitGroup{}
+	for _, t := range config.Records[domain] {
+		recordType := strings.ToUpper(t.Type)
+		remark := t.templateRemark()
+		if isPaused(db, domain, t.Name, remark) {
+			pauseRecordSet(db.Section(domain, t.Name), t.Name, recordType+"-"+remark, domainInfo, client)
+			continue
+		}
+		value, err := templateValue(t, domain, remarks)
+		if err != nil {
+			fmt.Printf("[%s] %s.%s[%s-%s] template skipped: %s\n", time.Now().Format("2006-01-02 15:04:05"), t.Name, domain, recordType, remark, err)
+			continue
+		}
+		section := db.Section(domain, t.Name)
+		set, _ := getRecordSet(section, recordType+"-"+remark)
+		lt := t
+		lt.Type = recordType
+		lt.Remark = remark
+		lValue := value
+		if len(set) == 0 || set[0].Id == nil {
+			wg.Add(1)
+			go createTemplateRecord(lt, domainInfo, lValue, client, section, &wg)
+		} else if normalizeValue(recordType, *set[0].Value) != value {
+			wg.Add(1)
+			go updateTemplateRecord(lt, domainInfo, lValue, client, set[0], section, &wg)
+		} else {
+			fmt.Printf("[%s] %s.%s[%s-%s] 值无变化\n", time.Now().Format("2006-01-02 15:04:05"), t.Name, domain, recordType, remark)
+		}
+	}
+	wg.Wait()
+}
+
+func createTemplateRecord(t TemplateRecord, domainInfo *dnspod.DomainInfo, value string, client *dnspod.Client, section *db.Section, wg *sync.WaitGroup) {
+	defer wg.Done()
+	fmt.Printf("[%s] creating %s.%s[%s-%s] , value:%s\n", time.Now().Format("2006-01-02 15:04:05"), t.Name, *domainInfo.Domain, t.Type, t.Remark, value) // 未有此记录,需要创建
+	recordLine := "默认"
+	dnsRemark := recordRemark(t.Remark)
+	createRecordRequest := dnspod.NewCreateRecordRequest()
+	createRecordRequest.SubDomain = &t.Name
+	createRecordRequest.Domain = domainInfo.Domain
+	createRecordRequest.RecordType = &t.Type
+	createRecordRequest.RecordLine = &recordLine
+	createRecordRequest.Value = &value
+	createRecordRequest.Remark = &dnsRemark
+	if t.TTL > 0 {
+		createRecordRequest.TTL = &t.TTL
+	}
+	if t.Type == "MX" {
+		createRecordRequest.MX = &t.MX
+	}
+	createRecordResponse, err := addRecord(createRecordRequest, client)
+	var tencentCloudSDKError *tencentErrors.TencentCloudSDKError
+	if errors.As(err, &tencentCloudSDKError) {
+		fmt.Printf("An API error has returned: %s\n", err)
+		req, _ := json.Marshal(createRecordRequest)
+		fmt.Printf("createRecordRequest: %s\n", req)
+		return
+	}
+	if createRecordResponse == nil || createRecordResponse.Response == nil || createRecordResponse.Response.RecordId == nil {
+		fmt.Printf("Empty RecordId returned: %v", createRecordResponse)
+		return
+	}
+	makeRecordCache(client, domainInfo, createRecordResponse.Response.RecordId, section, &t.Remark, nil)
+}
+
+func updateTemplateRecord(t TemplateRecord, domainInfo *dnspod.DomainInfo, value string, client *dnspod.Client, record *dnspod.RecordInfo, section *db.Section, wg *sync.WaitGroup) {
+	defer wg.Done()
+	fmt.Printf("[%s] Updating %s.%s[%s-%s], value:%s\n", time.Now().Format("2006-01-02 15:04:05"), t.Name, *domainInfo.Domain, t.Type, t.Remark, value)
+	modifyRecordRequest := dnspod.NewModifyRecordRequest()
+	modifyRecordRequest.Domain = domainInfo.Domain
+	modifyRecordRequest.RecordType = record.RecordType
+	modifyRecordRequest.RecordLine = record.RecordLine
+	modifyRecordRequest.RecordLineId = record.RecordLineId
+	modifyRecordRequest.Value = &value
+	modifyRecordRequest.RecordId = record.Id
+	modifyRecordRequest.SubDomain = &t.Name
+	modifyRecordRequest.Remark = record.Remark
+	modifyRecordRequest.MX = record.MX
+	if t.TTL > 0 {
+		modifyRecordRequest.TTL = &t.TTL
+	}
+	if t.Type == "MX" {
+		modifyRecordRequest.MX = &t.MX
+	}
+	var response *dnspod.ModifyRecordResponse
+	err := modifyRetrying(domainInfo, record, section, t.Remark, client, func() (err error) {
+		response, err = modifyRecord(modifyRecordRequest, record, client)
+		return err
+	})
+	if err != nil {
+		fmt.Printf("update failed: %s\n,%v\n", err, response)
+		req, _ := json.Marshal(modifyRecordRequest)
+		fmt.Printf("modifyRecordRequest: %s\n", req)
+		return
+	}
+	makeRecordCache(client, domainInfo, record.Id, section, &t.Remark, nil)
+}
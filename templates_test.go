@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	remarks := map[string]*addresses{
+		"telecom": {ips: map[string][]string{"A": {"192.0.2.1", "192.0.2.2"}, "AAAA": {"2001:db8::1"}}},
+		"unicom":  {ips: map[string][]string{"A": {"198.51.100.1"}}, unhealthy: true},
+		"empty":   {ips: map[string][]string{}},
+	}
+	tests := []struct {
+		typ, value string
+		want       string
+		err        string
+	}{
+		{"TXT", `v=spf1 ip4:{{ ip "telecom" }} -all`, "v=spf1 ip4:192.0.2.1 -all", ""},
+		{"TXT", `{{ ips "telecom" }}`, "192.0.2.1,192.0.2.2", ""},
+		{"AAAA", `{{ ip "telecom" "AAAA" }}`, "2001:db8::1", ""},
+		{"CNAME", `{{ if healthy "unicom" }}unicom{{ else }}telecom{{ end }}.{{ .Domain }}`, "telecom.example.com.", ""},
+		{"TXT", `{{ if has "empty" }}yes{{ else }}no{{ end }} {{ .Name }}`, "no www", ""},
+		{"TXT", `{{ ip "empty" }}`, "", "no address for empty"},
+		{"TXT", `{{ ips "mobile" }}`, "", "unknown ips mobile"},
+		{"TXT", `{{ ip "telecom"`, "", "unclosed action"},
+	}
+	for _, tt := range tests {
+		got, err := renderTemplate(TemplateRecord{Name: "www", Type: tt.typ, Value: tt.value}, "example.com", remarks)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("renderTemplate(%s) error = %v, want %q", tt.value, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("renderTemplate(%s) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestTemplateValueRendersOncePerRun(t *testing.T) {
+	saved := templateCache
+	defer func() { templateCache = saved }()
+	templateCache = make(map[string]templateEntry)
+
+	record := TemplateRecord{Name: "spf", Type: "TXT", Value: `{{ ip "telecom" }}`}
+	first, err := templateValue(record, "example.com", map[string]*addresses{"telecom": ipv4("192.0.2.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 地址在运行中变化时仍使用第一次生成的值, 与 currentState 保存的值一致
+	second, _ := templateValue(record, "example.com", map[string]*addresses{"telecom": ipv4("192.0.2.9")})
+	if first != "192.0.2.1" || second != first {
+		t.Errorf("templateValue() = %q then %q, want 192.0.2.1 twice", first, second)
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	for _, tt := range [][3]string{
+		{"cname", "target.example.com", "target.example.com."},
+		{"MX", "mail.example.com.", "mail.example.com."},
+		{"NS", " ns1.example.com\n", "ns1.example.com."},
+		{"SRV", "0 5 5060 sip.example.com", "0 5 5060 sip.example.com."},
+		{"CNAME", "", ""},
+		{"TXT", "v=spf1 -all ", "v=spf1 -all"},
+		{"A", "192.0.2.1", "192.0.2.1"},
+	} {
+		if got := normalizeValue(tt[0], tt[1]); got != tt[2] {
+			t.Errorf("normalizeValue(%s, %q) = %q, want %q", tt[0], tt[1], got, tt[2])
+		}
+	}
+}